@@ -0,0 +1,113 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrNotInteger = errors.New("value is not an integer")
+
+var _ Atomic = (*Mem)(nil)
+
+// Atomic is implemented by backends that can read and write a single key
+// without another writer slipping in between.
+type Atomic interface {
+	// CompareAndSwap sets k to new if its current value equals old. A nil
+	// old means k must not exist; a nil new deletes k. It reports whether
+	// the swap happened.
+	CompareAndSwap(k, old, new []byte) (bool, error)
+
+	// PutIfAbsent sets k to v unless k exists. It reports whether v was
+	// stored.
+	PutIfAbsent(k, v []byte) (bool, error)
+
+	// Increment adds delta to the integer stored under k, treating a
+	// missing key as 0, and returns the new value. Integers are stored as
+	// by EncodeInt; anything else fails with ErrNotInteger.
+	Increment(k []byte, delta int64) (int64, error)
+}
+
+// EncodeInt returns n as 8 bytes, big endian two's complement.
+func EncodeInt(n int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(n))
+}
+
+// DecodeInt is the inverse of EncodeInt.
+func DecodeInt(b []byte) (int64, error) {
+	if len(b) != 8 {
+		return 0, ErrNotInteger
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (m *Mem) CompareAndSwap(k, old, new []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	sk := string(k)
+	e, ok := m.get(sk)
+	if old == nil {
+		if ok {
+			return false, nil
+		}
+	} else if !ok || !bytes.Equal(e.v, old) {
+		return false, nil
+	}
+
+	if new == nil {
+		if ok {
+			m.del(sk)
+		}
+		return true, nil
+	}
+
+	m.put(sk, clone(new), 0)
+	return true, nil
+}
+
+func (m *Mem) PutIfAbsent(k, v []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	sk := string(k)
+	if _, ok := m.get(sk); ok {
+		return false, nil
+	}
+
+	m.put(sk, clone(v), 0)
+	return true, nil
+}
+
+// Increment keeps the key's TTL, if it has one, so it can back rate
+// limits and other expiring counters.
+func (m *Mem) Increment(k []byte, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	sk := string(k)
+	var n int64
+	e, ok := m.get(sk)
+	if ok {
+		var err error
+		if n, err = DecodeInt(e.v); err != nil {
+			return 0, err
+		}
+	}
+
+	n += delta
+	m.put(sk, EncodeInt(n), e.exp)
+	return n, nil
+}
@@ -0,0 +1,154 @@
+package store
+
+// Op is the kind of a single mutation.
+type Op uint8
+
+const (
+	OpPut Op = iota + 1
+	OpDelete
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Mutation is one Put or Delete. Value is nil for deletes.
+type Mutation struct {
+	Op    Op
+	Key   []byte
+	Value []byte
+}
+
+// Batch accumulates writes so they can be applied together. The zero
+// value is an empty batch ready to use.
+//
+// Deleting a key that doesn't exist is not an error inside a batch; the
+// delete is simply skipped.
+type Batch struct {
+	ops []Mutation
+}
+
+func (b *Batch) Put(k, v []byte) {
+	b.ops = append(b.ops, Mutation{OpPut, clone(k), clone(v)})
+}
+
+func (b *Batch) Delete(k []byte) {
+	b.ops = append(b.ops, Mutation{OpDelete, clone(k), nil})
+}
+
+// Len returns the number of queued mutations.
+func (b *Batch) Len() int { return len(b.ops) }
+
+// Reset empties the batch so it can be reused.
+func (b *Batch) Reset() {
+	clear(b.ops)
+	b.ops = b.ops[:0]
+}
+
+// Mutations returns the queued mutations in order. The slice must not be
+// modified.
+func (b *Batch) Mutations() []Mutation { return b.ops }
+
+// Batcher is implemented by backends that can apply a Batch atomically:
+// either every mutation becomes visible or none does.
+type Batcher interface {
+	Commit(b *Batch) error
+}
+
+// Apply commits b to be. When be is not a Batcher the mutations are
+// applied one by one and the first failure leaves the rest unapplied.
+func Apply(be Backend, b *Batch) error {
+	if bb, ok := be.(Batcher); ok {
+		return bb.Commit(b)
+	}
+
+	for _, op := range b.ops {
+		var err error
+		switch op.Op {
+		case OpPut:
+			err = be.Put(op.Key, op.Value)
+		case OpDelete:
+			if err = be.Delete(op.Key); err == ErrNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mem) Commit(b *Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	for _, op := range b.ops {
+		switch op.Op {
+		case OpPut:
+			m.put(string(op.Key), clone(op.Value), 0)
+		case OpDelete:
+			m.del(string(op.Key))
+		}
+	}
+
+	return nil
+}
+
+// Commit writes b as a single log record, so after a crash either the
+// whole batch is replayed or none of it is.
+func (l *Log) Commit(b *Batch) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	var (
+		body []byte
+		live = make(map[string]bool)
+	)
+
+	for _, op := range b.ops {
+		sk := string(op.Key)
+		switch op.Op {
+		case OpPut:
+			body = appendRecord(body, recPut, op.Key, op.Value)
+			live[sk] = true
+		case OpDelete:
+			exists, seen := live[sk]
+			if !seen {
+				_, exists = l.idx.get(sk)
+			}
+			if exists {
+				body = appendRecord(body, recDel, op.Key, nil)
+				live[sk] = false
+			}
+		}
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	off := l.size
+	if err := l.write(appendRecord(nil, recBatch, nil, body)); err != nil {
+		return err
+	}
+
+	l.apply(recBatch, nil, body, off)
+	l.maybeCompact()
+	return nil
+}
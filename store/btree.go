@@ -0,0 +1,384 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// in-memory B-tree keyed by string, loosely following google/btree.
+// clone is O(1): both trees share nodes and copy them lazily on write.
+
+const (
+	btreeDegree = 32
+	maxItems    = 2*btreeDegree - 1
+	minItems    = btreeDegree - 1
+)
+
+type item[V any] struct {
+	key string
+	val V
+}
+
+// copyOnWrite marks node ownership. A tree may only modify nodes that
+// carry its own marker; anything else is copied first.
+type copyOnWrite struct{ _ int }
+
+type node[V any] struct {
+	items    []item[V]
+	children []*node[V]
+	cow      *copyOnWrite
+}
+
+type btree[V any] struct {
+	root   *node[V]
+	length int
+	cow    *copyOnWrite
+}
+
+func (t *btree[V]) Len() int { return t.length }
+
+// clone returns a tree sharing every node with t. Neither tree sees the
+// other's later writes.
+func (t *btree[V]) clone() btree[V] {
+	out := *t
+	t.cow = new(copyOnWrite)
+	out.cow = new(copyOnWrite)
+	return out
+}
+
+// each visits the keys starting with prefix in ascending (or, if reverse
+// is set, descending) order until fn returns false.
+func (t *btree[V]) each(prefix string, reverse bool, fn func(k string, v V) bool) {
+	in := func(k string, v V) bool {
+		return strings.HasPrefix(k, prefix) && fn(k, v)
+	}
+
+	if !reverse {
+		t.ascend(prefix, in)
+		return
+	}
+
+	end, ok := prefixEnd(prefix)
+	t.descend(end, ok, in)
+}
+
+func (t *btree[V]) get(key string) (V, bool) {
+	n := t.root
+	for n != nil {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].val, true
+		}
+		if len(n.children) == 0 {
+			break
+		}
+		n = n.children[i]
+	}
+
+	var zero V
+	return zero, false
+}
+
+// set inserts or replaces key, returning the previous value if any.
+func (t *btree[V]) set(key string, val V) (V, bool) {
+	if t.cow == nil {
+		t.cow = new(copyOnWrite)
+	}
+
+	it := item[V]{key, val}
+
+	if t.root == nil {
+		t.root = &node[V]{items: []item[V]{it}, cow: t.cow}
+		t.length++
+		var zero V
+		return zero, false
+	}
+
+	t.root = t.root.mutableFor(t.cow)
+	if len(t.root.items) >= maxItems {
+		mid, second := t.root.split(maxItems / 2)
+		old := t.root
+		t.root = &node[V]{
+			items:    []item[V]{mid},
+			children: []*node[V]{old, second},
+			cow:      t.cow,
+		}
+	}
+
+	old, replaced := t.root.insert(it)
+	if !replaced {
+		t.length++
+	}
+	return old, replaced
+}
+
+// delete removes key, returning its value if it was present.
+func (t *btree[V]) delete(key string) (V, bool) {
+	if _, ok := t.get(key); !ok {
+		// don't copy a path for nothing
+		var zero V
+		return zero, false
+	}
+
+	t.root = t.root.mutableFor(t.cow)
+	out, _ := t.root.remove(key, removeKey)
+	if len(t.root.items) == 0 && len(t.root.children) > 0 {
+		t.root = t.root.children[0]
+	}
+
+	t.length--
+	return out.val, true
+}
+
+// ascend visits keys >= from in ascending order until fn returns false.
+func (t *btree[V]) ascend(from string, fn func(k string, v V) bool) {
+	if t.root != nil {
+		t.root.ascend(from, fn)
+	}
+}
+
+// descend visits keys < before in descending order until fn returns
+// false. If bounded is false every key is visited.
+func (t *btree[V]) descend(before string, bounded bool, fn func(k string, v V) bool) {
+	if t.root != nil {
+		t.root.descend(before, bounded, fn)
+	}
+}
+
+// mutableFor returns n itself if cow owns it, otherwise a copy that cow
+// owns.
+func (n *node[V]) mutableFor(cow *copyOnWrite) *node[V] {
+	if n.cow == cow {
+		return n
+	}
+
+	out := &node[V]{cow: cow}
+	out.items = append(make([]item[V], 0, maxItems), n.items...)
+	if len(n.children) > 0 {
+		out.children = append(make([]*node[V], 0, maxItems+1), n.children...)
+	}
+	return out
+}
+
+func (n *node[V]) mutableChild(i int) *node[V] {
+	c := n.children[i].mutableFor(n.cow)
+	n.children[i] = c
+	return c
+}
+
+// find returns the index of the first item >= key.
+func (n *node[V]) find(key string) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return n.items[i].key >= key
+	})
+	return i, i < len(n.items) && n.items[i].key == key
+}
+
+// split moves everything after items[i] into a new node and returns
+// items[i] together with that node.
+func (n *node[V]) split(i int) (item[V], *node[V]) {
+	mid := n.items[i]
+	next := &node[V]{cow: n.cow}
+
+	next.items = append(next.items, n.items[i+1:]...)
+	clear(n.items[i:])
+	n.items = n.items[:i]
+
+	if len(n.children) > 0 {
+		next.children = append(next.children, n.children[i+1:]...)
+		clear(n.children[i+1:])
+		n.children = n.children[:i+1]
+	}
+
+	return mid, next
+}
+
+// maybeSplitChild splits children[i] if it is full.
+func (n *node[V]) maybeSplitChild(i int) bool {
+	if len(n.children[i].items) < maxItems {
+		return false
+	}
+
+	mid, second := n.mutableChild(i).split(maxItems / 2)
+	n.items = slices.Insert(n.items, i, mid)
+	n.children = slices.Insert(n.children, i+1, second)
+	return true
+}
+
+func (n *node[V]) insert(it item[V]) (V, bool) {
+	i, found := n.find(it.key)
+	if found {
+		old := n.items[i].val
+		n.items[i] = it
+		return old, true
+	}
+
+	if len(n.children) == 0 {
+		n.items = slices.Insert(n.items, i, it)
+		var zero V
+		return zero, false
+	}
+
+	if n.maybeSplitChild(i) {
+		switch mid := n.items[i].key; {
+		case it.key > mid:
+			i++
+		case it.key == mid:
+			old := n.items[i].val
+			n.items[i] = it
+			return old, true
+		}
+	}
+
+	return n.mutableChild(i).insert(it)
+}
+
+const (
+	removeKey = iota
+	removeMax
+)
+
+func (n *node[V]) remove(key string, typ int) (item[V], bool) {
+	var (
+		i     int
+		found bool
+	)
+
+	switch typ {
+	case removeMax:
+		if len(n.children) == 0 {
+			out := n.items[len(n.items)-1]
+			n.items[len(n.items)-1] = item[V]{}
+			n.items = n.items[:len(n.items)-1]
+			return out, true
+		}
+		i = len(n.items)
+	case removeKey:
+		i, found = n.find(key)
+		if len(n.children) == 0 {
+			if !found {
+				return item[V]{}, false
+			}
+			out := n.items[i]
+			n.items = slices.Delete(n.items, i, i+1)
+			return out, true
+		}
+	}
+
+	// make sure the child we descend into can afford to lose an item
+	if len(n.children[i].items) <= minItems {
+		return n.growChildAndRemove(i, key, typ)
+	}
+
+	child := n.mutableChild(i)
+	if found {
+		out := n.items[i]
+		n.items[i], _ = child.remove("", removeMax)
+		return out, true
+	}
+
+	return child.remove(key, typ)
+}
+
+func (n *node[V]) growChildAndRemove(i int, key string, typ int) (item[V], bool) {
+	switch {
+	case i > 0 && len(n.children[i-1].items) > minItems:
+		// steal from the left sibling
+		child, from := n.mutableChild(i), n.mutableChild(i-1)
+		stolen := from.items[len(from.items)-1]
+		from.items[len(from.items)-1] = item[V]{}
+		from.items = from.items[:len(from.items)-1]
+
+		child.items = slices.Insert(child.items, 0, n.items[i-1])
+		n.items[i-1] = stolen
+
+		if len(from.children) > 0 {
+			c := from.children[len(from.children)-1]
+			from.children[len(from.children)-1] = nil
+			from.children = from.children[:len(from.children)-1]
+			child.children = slices.Insert(child.children, 0, c)
+		}
+
+	case i < len(n.items) && len(n.children[i+1].items) > minItems:
+		// steal from the right sibling
+		child, from := n.mutableChild(i), n.mutableChild(i+1)
+		stolen := from.items[0]
+		from.items = slices.Delete(from.items, 0, 1)
+
+		child.items = append(child.items, n.items[i])
+		n.items[i] = stolen
+
+		if len(from.children) > 0 {
+			child.children = append(child.children, from.children[0])
+			from.children = slices.Delete(from.children, 0, 1)
+		}
+
+	default:
+		// merge with the right sibling
+		if i >= len(n.items) {
+			i--
+		}
+		child, right := n.mutableChild(i), n.children[i+1]
+
+		child.items = append(child.items, n.items[i])
+		child.items = append(child.items, right.items...)
+		child.children = append(child.children, right.children...)
+
+		n.items = slices.Delete(n.items, i, i+1)
+		n.children = slices.Delete(n.children, i+1, i+2)
+	}
+
+	return n.remove(key, typ)
+}
+
+func (n *node[V]) ascend(from string, fn func(k string, v V) bool) bool {
+	i, _ := n.find(from)
+
+	for ; i < len(n.items); i++ {
+		if len(n.children) > 0 && !n.children[i].ascend(from, fn) {
+			return false
+		}
+		if !fn(n.items[i].key, n.items[i].val) {
+			return false
+		}
+	}
+
+	if len(n.children) > 0 {
+		return n.children[len(n.children)-1].ascend(from, fn)
+	}
+	return true
+}
+
+func (n *node[V]) descend(before string, bounded bool, fn func(k string, v V) bool) bool {
+	i := len(n.items)
+	if bounded {
+		i, _ = n.find(before)
+	}
+
+	if len(n.children) > 0 && !n.children[i].descend(before, bounded, fn) {
+		return false
+	}
+
+	for i--; i >= 0; i-- {
+		if !fn(n.items[i].key, n.items[i].val) {
+			return false
+		}
+		if len(n.children) > 0 && !n.children[i].descend(before, bounded, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// prefixEnd returns the smallest key greater than every key starting
+// with prefix. ok is false when no such key exists.
+func prefixEnd(prefix string) (string, bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			return prefix[:i] + string([]byte{prefix[i] + 1}), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// Bucket keys are laid out so that a bucket's own data and its children
+// never share a prefix:
+//
+//	child bucket: parent + 0x01 + uvarint(len(name)) + name
+//	data key:     bucket + 0x00 + key
+//
+// Raw keys of the underlying Backend that start with 0x01 are therefore
+// reserved for buckets.
+const (
+	bucketData  = 0x00
+	bucketChild = 0x01
+)
+
+var (
+	_ Backend      = (*Bucket)(nil)
+	_ Batcher      = (*Bucket)(nil)
+	_ RangeScanner = (*Bucket)(nil)
+)
+
+// Bucket is a namespaced view of a Backend. It only sees its own keys,
+// not those of the parent or of nested buckets, so several subsystems can
+// share one Backend without colliding.
+type Bucket struct {
+	b      Backend
+	name   string
+	path   []byte // encoded bucket path
+	data   []byte // path + bucketData
+	closed atomic.Bool
+}
+
+// NewBucket returns the top-level bucket called name inside b.
+func NewBucket(b Backend, name string) *Bucket {
+	return newBucket(b, nil, name)
+}
+
+func newBucket(b Backend, parent []byte, name string) *Bucket {
+	path := append([]byte(nil), parent...)
+	path = append(path, bucketChild)
+	path = binary.AppendUvarint(path, uint64(len(name)))
+	path = append(path, name...)
+
+	return &Bucket{
+		b:    b,
+		name: name,
+		path: path,
+		data: append(clone(path), bucketData),
+	}
+}
+
+// Bucket returns the bucket called name nested inside bk.
+func (bk *Bucket) Bucket(name string) *Bucket {
+	return newBucket(bk.b, bk.path, name)
+}
+
+// Name returns the bucket's own name.
+func (bk *Bucket) Name() string { return bk.name }
+
+// key maps a bucket key to the underlying Backend.
+func (bk *Bucket) key(k []byte) []byte {
+	out := make([]byte, 0, len(bk.data)+len(k))
+	out = append(out, bk.data...)
+	return append(out, k...)
+}
+
+func (bk *Bucket) Put(k, v []byte) error {
+	if bk.closed.Load() {
+		return ErrClosed
+	}
+	return bk.b.Put(bk.key(k), v)
+}
+
+func (bk *Bucket) Get(k []byte) ([]byte, error) {
+	if bk.closed.Load() {
+		return nil, ErrClosed
+	}
+	return bk.b.Get(bk.key(k))
+}
+
+func (bk *Bucket) Delete(k []byte) error {
+	if bk.closed.Load() {
+		return ErrClosed
+	}
+	return bk.b.Delete(bk.key(k))
+}
+
+func (bk *Bucket) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	if bk.closed.Load() {
+		return ErrClosed
+	}
+
+	n := len(bk.data)
+	return bk.b.Scan(bk.key(prefix), func(k, v []byte) error {
+		return fn(k[n:], v)
+	})
+}
+
+func (bk *Bucket) Range(fn func(k, v []byte) error) error {
+	return bk.Scan(nil, fn)
+}
+
+func (bk *Bucket) Keys(prefix []byte) [][]byte {
+	if bk.closed.Load() {
+		return nil
+	}
+
+	keys := bk.b.Keys(bk.key(prefix))
+	for i, k := range keys {
+		keys[i] = k[len(bk.data):]
+	}
+	return keys
+}
+
+func (bk *Bucket) Exists(k []byte) bool {
+	if bk.closed.Load() {
+		return false
+	}
+	return bk.b.Exists(bk.key(k))
+}
+
+// Len counts the bucket's keys, which means listing them.
+func (bk *Bucket) Len() int {
+	if bk.closed.Load() {
+		return 0
+	}
+	return len(bk.b.Keys(bk.data))
+}
+
+// Commit applies b inside the bucket. It is atomic if the underlying
+// Backend is a Batcher.
+func (bk *Bucket) Commit(b *Batch) error {
+	if bk.closed.Load() {
+		return ErrClosed
+	}
+
+	var inner Batch
+	for _, op := range b.ops {
+		switch op.Op {
+		case OpPut:
+			inner.Put(bk.key(op.Key), op.Value)
+		case OpDelete:
+			inner.Delete(bk.key(op.Key))
+		}
+	}
+
+	return Apply(bk.b, &inner)
+}
+
+func (bk *Bucket) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	if bk.closed.Load() {
+		return "", ErrClosed
+	}
+
+	start, err := q.start()
+	if err != nil {
+		return "", err
+	}
+
+	inner := RangeQuery{Start: bk.key(start), Limit: q.Limit}
+	if q.End != nil {
+		inner.End = bk.key(q.End)
+	} else if end, ok := prefixEnd(string(bk.data)); ok {
+		inner.End = []byte(end)
+	}
+
+	n := len(bk.data)
+	next, err := ScanRange(bk.b, inner, func(k, v []byte) error {
+		return fn(k[n:], v)
+	})
+	if err != nil || next == "" {
+		return "", err
+	}
+
+	// re-issue the cursor relative to the bucket
+	k, err := base64.RawURLEncoding.DecodeString(next)
+	if err != nil || len(k) < n {
+		return "", ErrBadCursor
+	}
+	return encodeCursor(string(k[n:])), nil
+}
+
+// Close detaches the view. The underlying Backend stays open.
+func (bk *Bucket) Close() error {
+	bk.closed.Store(true)
+	return nil
+}
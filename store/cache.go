@@ -0,0 +1,449 @@
+package store
+
+import (
+	"container/heap"
+	"sync"
+)
+
+var _ Backend = (*Cache)(nil)
+
+// Eviction picks which entry a full Cache drops first.
+type Eviction int
+
+const (
+	LRU Eviction = iota // least recently used
+	LFU                 // least frequently used, ties broken by recency
+)
+
+// CacheOption configures a Cache.
+type CacheOption func(*Cache)
+
+// WithMaxEntries bounds the number of cached keys.
+func WithMaxEntries(n int) CacheOption {
+	return func(c *Cache) { c.maxEntries = n }
+}
+
+// WithMaxBytes bounds the total size of cached keys and values.
+func WithMaxBytes(n int64) CacheOption {
+	return func(c *Cache) { c.maxBytes = n }
+}
+
+// WithEviction sets the eviction policy. The default is LRU.
+func WithEviction(p Eviction) CacheOption {
+	return func(c *Cache) { c.policy = p }
+}
+
+// WithWriteBack keeps writes in the cache and only hands them to the
+// inner Backend on eviction, Flush or Close. The default is to write
+// through.
+func WithWriteBack() CacheOption {
+	return func(c *Cache) { c.writeBack = true }
+}
+
+// CacheStats is a point-in-time copy of a Cache's counters.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+// Cache keeps hot values of an inner Backend in memory. Scan, Range, Keys
+// and Len are always answered by the inner Backend (after a Flush in
+// write-back mode).
+type Cache struct {
+	mu    sync.Mutex
+	inner Backend
+
+	maxEntries int
+	maxBytes   int64
+	policy     Eviction
+	writeBack  bool
+
+	items map[string]*cacheEntry
+	queue cacheQueue
+	bytes int64
+	tick  uint64
+	stats CacheStats
+
+	closed bool
+}
+
+type cacheEntry struct {
+	key   string
+	val   []byte
+	del   bool // write-back tombstone
+	dirty bool
+
+	freq  uint64
+	last  uint64
+	index int
+}
+
+func (e *cacheEntry) size() int64 { return int64(len(e.key) + len(e.val)) }
+
+// NewCache wraps inner. Without a bound it holds at most 1024 entries.
+func NewCache(inner Backend, opts ...CacheOption) *Cache {
+	c := &Cache{
+		inner: inner,
+		items: make(map[string]*cacheEntry),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.maxEntries <= 0 && c.maxBytes <= 0 {
+		c.maxEntries = 1024
+	}
+
+	c.queue.policy = c.policy
+	return c
+}
+
+// Stats returns the current counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Entries = len(c.items)
+	s.Bytes = c.bytes
+	return s
+}
+
+// touch records an access to e. Caller must hold c.mu.
+func (c *Cache) touch(e *cacheEntry) {
+	c.tick++
+	e.freq++
+	e.last = c.tick
+	heap.Fix(&c.queue, e.index)
+}
+
+// store caches v under sk and evicts as needed. If an eviction fails the
+// cache is put back the way it was, so a write-back entry that could not
+// make room is not left behind. Caller must hold c.mu.
+func (c *Cache) store(sk string, v []byte, del, dirty bool) error {
+	if e, ok := c.items[sk]; ok {
+		prev := *e
+		c.bytes -= e.size()
+		e.val, e.del, e.dirty = v, del, dirty
+		c.bytes += e.size()
+		c.touch(e)
+
+		if err := c.evict(); err != nil {
+			if c.items[sk] == e {
+				c.bytes -= e.size()
+				e.val, e.del, e.dirty = prev.val, prev.del, prev.dirty
+				e.freq, e.last = prev.freq, prev.last
+				c.bytes += e.size()
+				heap.Fix(&c.queue, e.index)
+			}
+			return err
+		}
+		return nil
+	}
+
+	e := &cacheEntry{key: sk, val: v, del: del, dirty: dirty}
+	if c.maxBytes > 0 && e.size() > c.maxBytes {
+		// too big to ever fit; write-back has to pass it on right away
+		if dirty {
+			return c.flushEntry(e)
+		}
+		return nil
+	}
+
+	c.tick++
+	e.freq, e.last = 1, c.tick
+	heap.Push(&c.queue, e)
+	c.items[sk] = e
+	c.bytes += e.size()
+
+	if err := c.evict(); err != nil {
+		if c.items[sk] == e {
+			c.remove(e)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove drops e from the cache. Caller must hold c.mu.
+func (c *Cache) remove(e *cacheEntry) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
+
+// evict drops entries until the cache is within bounds. Caller must hold
+// c.mu.
+func (c *Cache) evict() error {
+	for len(c.queue.items) > 0 &&
+		((c.maxEntries > 0 && len(c.items) > c.maxEntries) ||
+			(c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+
+		e := c.queue.items[0]
+		if err := c.flushEntry(e); err != nil {
+			return err
+		}
+
+		c.remove(e)
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+// flushEntry writes a dirty entry to the inner Backend. Caller must hold
+// c.mu.
+func (c *Cache) flushEntry(e *cacheEntry) error {
+	if !e.dirty {
+		return nil
+	}
+
+	var err error
+	if e.del {
+		if err = c.inner.Delete([]byte(e.key)); err == ErrNotFound {
+			err = nil
+		}
+	} else {
+		err = c.inner.Put([]byte(e.key), e.val)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.dirty = false
+	return nil
+}
+
+// flush writes every dirty entry back. Caller must hold c.mu.
+func (c *Cache) flush() error {
+	if !c.writeBack {
+		return nil
+	}
+
+	for _, e := range c.items {
+		if err := c.flushEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes all pending write-back entries to the inner Backend.
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	return c.flush()
+}
+
+func (c *Cache) Put(k, v []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if !c.writeBack {
+		if err := c.inner.Put(k, v); err != nil {
+			return err
+		}
+	}
+
+	return c.store(string(k), clone(v), false, c.writeBack)
+}
+
+func (c *Cache) Get(k []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	sk := string(k)
+	if e, ok := c.items[sk]; ok {
+		c.stats.Hits++
+		c.touch(e)
+		if e.del {
+			return nil, ErrNotFound
+		}
+		return clone(e.val), nil
+	}
+
+	c.stats.Misses++
+	v, err := c.inner.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.store(sk, v, false, false); err != nil {
+		return nil, err
+	}
+	return clone(v), nil
+}
+
+func (c *Cache) Delete(k []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	sk := string(k)
+	if !c.writeBack {
+		if err := c.inner.Delete(k); err != nil {
+			return err
+		}
+		if e, ok := c.items[sk]; ok {
+			c.remove(e)
+		}
+		return nil
+	}
+
+	if e, ok := c.items[sk]; ok {
+		if e.del {
+			return ErrNotFound
+		}
+	} else if !c.inner.Exists(k) {
+		return ErrNotFound
+	}
+
+	return c.store(sk, nil, true, true)
+}
+
+func (c *Cache) Exists(k []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	if e, ok := c.items[string(k)]; ok {
+		return !e.del
+	}
+	return c.inner.Exists(k)
+}
+
+// passthrough runs fn against the inner Backend once pending writes have
+// landed there.
+func (c *Cache) passthrough(fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	return fn()
+}
+
+func (c *Cache) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	var pairs [][2][]byte
+	err := c.passthrough(func() error {
+		return c.inner.Scan(prefix, func(k, v []byte) error {
+			pairs = append(pairs, [2][]byte{k, v})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// fn runs unlocked so it may use the cache
+	for _, p := range pairs {
+		if err := fn(p[0], p[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) Range(fn func(k, v []byte) error) error {
+	return c.Scan(nil, fn)
+}
+
+func (c *Cache) Keys(prefix []byte) [][]byte {
+	var keys [][]byte
+	c.passthrough(func() error {
+		keys = c.inner.Keys(prefix)
+		return nil
+	})
+	return keys
+}
+
+func (c *Cache) Len() int {
+	var n int
+	c.passthrough(func() error {
+		n = c.inner.Len()
+		return nil
+	})
+	return n
+}
+
+// Close flushes pending writes and closes the inner Backend. If the flush
+// fails nothing is closed and the unwritten entries stay cached, so Close
+// can be retried.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	c.closed = true
+	c.items = nil
+	c.queue.items = nil
+	return c.inner.Close()
+}
+
+// cacheQueue is a min-heap of entries ordered by eviction priority.
+type cacheQueue struct {
+	items  []*cacheEntry
+	policy Eviction
+}
+
+func (q *cacheQueue) Len() int { return len(q.items) }
+
+func (q *cacheQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.policy == LFU && a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.last < b.last
+}
+
+func (q *cacheQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+func (q *cacheQueue) Push(x any) {
+	e := x.(*cacheEntry)
+	e.index = len(q.items)
+	q.items = append(q.items, e)
+}
+
+func (q *cacheQueue) Pop() any {
+	n := len(q.items)
+	e := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return e
+}
@@ -0,0 +1,285 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrBadCompression = errors.New("malformed compressed value")
+
+var (
+	_ Backend      = (*Compressed)(nil)
+	_ Batcher      = (*Compressed)(nil)
+	_ RangeScanner = (*Compressed)(nil)
+)
+
+// Compression is the tag byte stored in front of every value.
+type Compression byte
+
+const (
+	Raw   Compression = iota // stored as is
+	Flate                    // compress/flate
+	Gzip                     // compress/gzip
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Raw:
+		return "raw"
+	case Flate:
+		return "flate"
+	case Gzip:
+		return "gzip"
+	}
+	return "unknown"
+}
+
+// CompressOption configures a Compressed backend.
+type CompressOption func(*Compressed)
+
+// WithThreshold sets the smallest value that gets compressed. The default
+// is 512 bytes.
+func WithThreshold(n int) CompressOption {
+	return func(c *Compressed) { c.threshold = n }
+}
+
+// WithAlgorithm picks the algorithm for new values. The default is Flate;
+// values written with another algorithm can still be read.
+func WithAlgorithm(a Compression) CompressOption {
+	return func(c *Compressed) { c.algo = a }
+}
+
+// WithLevel sets the flate/gzip compression level.
+func WithLevel(level int) CompressOption {
+	return func(c *Compressed) { c.level = level }
+}
+
+// CompressStats is a point-in-time copy of a Compressed backend's
+// counters. Bytes are counted on Put only.
+type CompressStats struct {
+	Values      uint64 // values written
+	Compressed  uint64 // values stored compressed
+	RawBytes    uint64 // bytes handed to Put
+	StoredBytes uint64 // bytes written to the inner Backend, tags included
+}
+
+// Ratio is StoredBytes/RawBytes, or 1 if nothing was written.
+func (s CompressStats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 1
+	}
+	return float64(s.StoredBytes) / float64(s.RawBytes)
+}
+
+// Compressed compresses large values of an inner Backend. Each stored
+// value starts with a Compression tag; values that don't shrink are
+// stored raw.
+type Compressed struct {
+	inner     Backend
+	threshold int
+	algo      Compression
+	level     int
+
+	buffers sync.Pool
+
+	values, compressed atomic.Uint64
+	rawBytes, stored   atomic.Uint64
+}
+
+// NewCompressed wraps inner.
+func NewCompressed(inner Backend, opts ...CompressOption) *Compressed {
+	c := &Compressed{
+		inner:     inner,
+		threshold: 512,
+		algo:      Flate,
+		level:     flate.DefaultCompression,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	c.buffers.New = func() any { return new(bytes.Buffer) }
+	return c
+}
+
+// Stats returns the current counters.
+func (c *Compressed) Stats() CompressStats {
+	return CompressStats{
+		Values:      c.values.Load(),
+		Compressed:  c.compressed.Load(),
+		RawBytes:    c.rawBytes.Load(),
+		StoredBytes: c.stored.Load(),
+	}
+}
+
+// encode returns the tagged form of v.
+func (c *Compressed) encode(v []byte) ([]byte, error) {
+	out, err := c.compress(v)
+	if err != nil {
+		return nil, err
+	}
+
+	c.values.Add(1)
+	c.rawBytes.Add(uint64(len(v)))
+	c.stored.Add(uint64(len(out)))
+	if Compression(out[0]) != Raw {
+		c.compressed.Add(1)
+	}
+	return out, nil
+}
+
+func (c *Compressed) compress(v []byte) ([]byte, error) {
+	if len(v) < c.threshold || c.algo == Raw {
+		return append([]byte{byte(Raw)}, v...), nil
+	}
+
+	buf := c.buffers.Get().(*bytes.Buffer)
+	defer c.buffers.Put(buf)
+	buf.Reset()
+	buf.WriteByte(byte(c.algo))
+
+	var (
+		w   io.WriteCloser
+		err error
+	)
+	switch c.algo {
+	case Flate:
+		w, err = flate.NewWriter(buf, c.level)
+	case Gzip:
+		w, err = gzip.NewWriterLevel(buf, c.level)
+	default:
+		return nil, fmt.Errorf("unknown compression %v", c.algo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(v); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	// not worth it
+	if buf.Len() >= len(v)+1 {
+		return append([]byte{byte(Raw)}, v...), nil
+	}
+	return clone(buf.Bytes()), nil
+}
+
+// decode undoes encode.
+func (c *Compressed) decode(v []byte) ([]byte, error) {
+	if len(v) == 0 {
+		return nil, ErrBadCompression
+	}
+
+	var r io.ReadCloser
+	switch Compression(v[0]) {
+	case Raw:
+		return v[1:], nil
+	case Flate:
+		r = flate.NewReader(bytes.NewReader(v[1:]))
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(v[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadCompression, err)
+		}
+		r = gr
+	default:
+		return nil, fmt.Errorf("%w: unknown tag %#x", ErrBadCompression, v[0])
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCompression, err)
+	}
+	return out, nil
+}
+
+func (c *Compressed) Put(k, v []byte) error {
+	out, err := c.encode(v)
+	if err != nil {
+		return err
+	}
+	return c.inner.Put(k, out)
+}
+
+func (c *Compressed) Get(k []byte) ([]byte, error) {
+	v, err := c.inner.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(v)
+}
+
+func (c *Compressed) Delete(k []byte) error {
+	return c.inner.Delete(k)
+}
+
+func (c *Compressed) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	return c.inner.Scan(prefix, func(k, v []byte) error {
+		out, err := c.decode(v)
+		if err != nil {
+			return err
+		}
+		return fn(k, out)
+	})
+}
+
+func (c *Compressed) Range(fn func(k, v []byte) error) error {
+	return c.Scan(nil, fn)
+}
+
+func (c *Compressed) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	return ScanRange(c.inner, q, func(k, v []byte) error {
+		out, err := c.decode(v)
+		if err != nil {
+			return err
+		}
+		return fn(k, out)
+	})
+}
+
+func (c *Compressed) Keys(prefix []byte) [][]byte {
+	return c.inner.Keys(prefix)
+}
+
+func (c *Compressed) Exists(k []byte) bool {
+	return c.inner.Exists(k)
+}
+
+func (c *Compressed) Len() int {
+	return c.inner.Len()
+}
+
+// Commit compresses the batch's values and hands it on. It is atomic if
+// the inner Backend is a Batcher.
+func (c *Compressed) Commit(b *Batch) error {
+	var inner Batch
+	for _, op := range b.ops {
+		switch op.Op {
+		case OpPut:
+			out, err := c.encode(op.Value)
+			if err != nil {
+				return err
+			}
+			inner.ops = append(inner.ops, Mutation{OpPut, op.Key, out})
+		case OpDelete:
+			inner.Delete(op.Key)
+		}
+	}
+
+	return Apply(c.inner, &inner)
+}
+
+func (c *Compressed) Close() error {
+	return c.inner.Close()
+}
@@ -0,0 +1,54 @@
+package store_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+func TestCompressedScanRange(t *testing.T) {
+	c := store.NewCompressed(store.NewMem(), store.WithThreshold(16))
+	defer c.Close()
+
+	want := make(map[string][]byte)
+	for i := range 10 {
+		k := fmt.Sprintf("k%02d", i)
+		v := bytes.Repeat([]byte(k), 100)
+		if err := c.Put([]byte(k), v); err != nil {
+			t.Fatal(err)
+		}
+		want[k] = v
+	}
+
+	var (
+		got   []string
+		pages int
+		q     = store.RangeQuery{Start: []byte("k02"), End: []byte("k09"), Limit: 3}
+	)
+	for {
+		next, err := store.ScanRange(c, q, func(k, v []byte) error {
+			if !bytes.Equal(v, want[string(k)]) {
+				t.Fatalf("value of %s not decoded: %q", k, v)
+			}
+			got = append(got, string(k))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ScanRange: %v", err)
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+
+	if fmt.Sprint(got) != "[k02 k03 k04 k05 k06 k07 k08]" {
+		t.Fatalf("ScanRange returned %v", got)
+	}
+	if pages != 3 {
+		t.Fatalf("took %d pages, want 3", pages)
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import "context"
+
+var _ ContextBackend = (*Mem)(nil)
+
+// ContextBackend is a Backend whose operations also come in a variant
+// that takes a context. Implementations give up as soon as ctx is done,
+// and scans check it between callbacks. Remote backends may also use its
+// deadline.
+type ContextBackend interface {
+	Backend
+
+	PutCtx(ctx context.Context, key, val []byte) error
+	GetCtx(ctx context.Context, key []byte) ([]byte, error)
+	DeleteCtx(ctx context.Context, key []byte) error
+	ScanCtx(ctx context.Context, prefix []byte, fn func(k, v []byte) error) error
+	RangeCtx(ctx context.Context, fn func(k, v []byte) error) error
+	KeysCtx(ctx context.Context, prefix []byte) ([][]byte, error)
+	LenCtx(ctx context.Context) (int, error)
+	ExistsCtx(ctx context.Context, key []byte) (bool, error)
+}
+
+// Lift returns b as a ContextBackend. Backends that already are one are
+// returned as is; others are wrapped so that ctx is checked before every
+// call and between scan callbacks. The wrapper can't interrupt a call
+// already in progress.
+func Lift(b Backend) ContextBackend {
+	if cb, ok := b.(ContextBackend); ok {
+		return cb
+	}
+	return lifted{b}
+}
+
+type lifted struct {
+	Backend
+}
+
+func (l lifted) PutCtx(ctx context.Context, k, v []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Put(k, v)
+}
+
+func (l lifted) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.Get(k)
+}
+
+func (l lifted) DeleteCtx(ctx context.Context, k []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Delete(k)
+}
+
+func (l lifted) ScanCtx(ctx context.Context, prefix []byte, fn func(k, v []byte) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Scan(prefix, checkCtx(ctx, fn))
+}
+
+func (l lifted) RangeCtx(ctx context.Context, fn func(k, v []byte) error) error {
+	return l.ScanCtx(ctx, nil, fn)
+}
+
+func (l lifted) KeysCtx(ctx context.Context, prefix []byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.Keys(prefix), nil
+}
+
+func (l lifted) LenCtx(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return l.Len(), nil
+}
+
+func (l lifted) ExistsCtx(ctx context.Context, k []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return l.Exists(k), nil
+}
+
+// checkCtx wraps a scan callback so the scan stops with ctx's error once
+// ctx is done.
+func checkCtx(ctx context.Context, fn func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, v []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(k, v)
+	}
+}
+
+func (m *Mem) PutCtx(ctx context.Context, k, v []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Put(k, v)
+}
+
+func (m *Mem) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Get(k)
+}
+
+func (m *Mem) DeleteCtx(ctx context.Context, k []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Delete(k)
+}
+
+// ScanCtx is Scan that stops with ctx's error once ctx is done, checked
+// before each callback.
+func (m *Mem) ScanCtx(ctx context.Context, prefix []byte, fn func(k, v []byte) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.scan(prefix, false, checkCtx(ctx, fn))
+}
+
+func (m *Mem) RangeCtx(ctx context.Context, fn func(k, v []byte) error) error {
+	return m.ScanCtx(ctx, nil, fn)
+}
+
+func (m *Mem) KeysCtx(ctx context.Context, prefix []byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Keys(prefix), nil
+}
+
+func (m *Mem) LenCtx(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return m.Len(), nil
+}
+
+func (m *Mem) ExistsCtx(ctx context.Context, k []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return m.Exists(k), nil
+}
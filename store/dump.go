@@ -0,0 +1,313 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"unicode/utf8"
+)
+
+var ErrBadDump = errors.New("malformed dump")
+
+// Binary dump format:
+//
+//	"XSTD" 0x01                                   magic, version
+//	0x01 uvarint(klen) key uvarint(vlen) value    one per pair
+//	0x00 uvarint(count) crc32c                    trailer
+//
+// The checksum (castagnoli, little endian) covers every byte before it.
+const (
+	dumpMagic   = "XSTD"
+	dumpVersion = 1
+
+	dumpPair = 0x01
+	dumpEnd  = 0x00
+)
+
+// Dump writes every pair of b to w in key order (for ordered backends).
+// Metadata keys such as SchemaKey are left out, so a restored dump starts
+// at schema version 0.
+func Dump(b Backend, w io.Writer) error {
+	return dump(b, w, false)
+}
+
+// dump is Dump, optionally keeping metadata keys.
+func dump(b Backend, w io.Writer, meta bool) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.New(castagnoli)
+	out := io.MultiWriter(bw, crc)
+
+	if _, err := out.Write(append([]byte(dumpMagic), dumpVersion)); err != nil {
+		return err
+	}
+
+	var (
+		buf   []byte
+		count uint64
+	)
+
+	err := b.Range(func(k, v []byte) error {
+		if !meta && IsMeta(k) {
+			return nil
+		}
+
+		buf = append(buf[:0], dumpPair)
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		buf = append(buf, v...)
+		count++
+
+		_, err := out.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	buf = binary.AppendUvarint(append(buf[:0], dumpEnd), count)
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf[:0], crc.Sum32())
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// LoadOption configures Load and LoadJSON.
+type LoadOption func(*loader)
+
+// WithChunkSize makes Load and LoadJSON write pairs in batches of n as
+// they are read, instead of in one batch at the end. Memory use is then
+// bounded by the chunk, but a dump found to be bad partway through leaves
+// the chunks before the damage written.
+func WithChunkSize(n int) LoadOption {
+	return func(l *loader) { l.chunk = n }
+}
+
+// loader collects loaded pairs and writes them into b.
+type loader struct {
+	b     Backend
+	batch Batch
+	chunk int
+	count uint64
+}
+
+func newLoader(b Backend, opts []LoadOption) *loader {
+	l := &loader{b: b}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+func (l *loader) put(k, v []byte) error {
+	l.batch.ops = append(l.batch.ops, Mutation{OpPut, k, v})
+	l.count++
+
+	if l.chunk > 0 && l.batch.Len() >= l.chunk {
+		return l.flush()
+	}
+	return nil
+}
+
+func (l *loader) flush() error {
+	err := Apply(l.b, &l.batch)
+	l.batch.Reset()
+	return err
+}
+
+// Load reads a dump produced by Dump and writes its pairs into b; existing
+// keys not in the dump are left alone. Nothing is written unless the
+// whole dump checks out, so the entire dump is held in memory until the
+// end. Use WithChunkSize to trade that guarantee for bounded memory.
+func Load(b Backend, r io.Reader, opts ...LoadOption) error {
+	crc := crc32.New(castagnoli)
+	br := &dumpReader{r: bufio.NewReader(r), crc: crc}
+
+	head := make([]byte, len(dumpMagic)+1)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+	if string(head[:len(dumpMagic)]) != dumpMagic {
+		return fmt.Errorf("%w: bad magic", ErrBadDump)
+	}
+	if head[len(dumpMagic)] != dumpVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadDump, head[len(dumpMagic)])
+	}
+
+	l := newLoader(b, opts)
+
+	for {
+		tag, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrBadDump, err)
+		}
+
+		if tag == dumpEnd {
+			break
+		}
+		if tag != dumpPair {
+			return fmt.Errorf("%w: bad record tag %#x", ErrBadDump, tag)
+		}
+
+		k, err := br.chunk()
+		if err != nil {
+			return err
+		}
+		v, err := br.chunk()
+		if err != nil {
+			return err
+		}
+
+		if err := l.put(k, v); err != nil {
+			return err
+		}
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil || count != l.count {
+		return fmt.Errorf("%w: pair count mismatch", ErrBadDump)
+	}
+
+	sum := crc.Sum32()
+	var tail [4]byte
+	if _, err := io.ReadFull(br.r, tail[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+	if binary.LittleEndian.Uint32(tail[:]) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrBadDump)
+	}
+
+	return l.flush()
+}
+
+// dumpReader hashes everything read through it.
+type dumpReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (d *dumpReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.crc.Write(p[:n])
+	return n, err
+}
+
+func (d *dumpReader) ReadByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == nil {
+		d.crc.Write([]byte{c})
+	}
+	return c, err
+}
+
+// chunk reads a length-prefixed byte string.
+func (d *dumpReader) chunk() ([]byte, error) {
+	n, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+
+	// don't trust n for the allocation; a corrupt length would be huge
+	var buf bytes.Buffer
+	buf.Grow(int(min(n, 1<<16)))
+
+	if _, err := io.CopyN(&buf, d, int64(n)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonPair is one line of a JSON Lines dump. Keys and values that are
+// valid UTF-8 are written as plain strings, anything else as base64 in
+// the *64 field.
+type jsonPair struct {
+	Key     string `json:"key,omitempty"`
+	Key64   string `json:"key64,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Value64 string `json:"value64,omitempty"`
+}
+
+func encodeJSONField(b []byte) (plain, b64 string) {
+	if utf8.Valid(b) {
+		return string(b), ""
+	}
+	return "", base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeJSONField(plain, b64 string) ([]byte, error) {
+	if b64 != "" {
+		return base64.StdEncoding.DecodeString(b64)
+	}
+	return []byte(plain), nil
+}
+
+// DumpJSON writes every pair of b to w as JSON Lines, one object per
+// pair. It is meant for humans and diffs; use Dump for backups. Like
+// Dump, it leaves out metadata keys.
+func DumpJSON(b Backend, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	err := b.Range(func(k, v []byte) error {
+		if IsMeta(k) {
+			return nil
+		}
+
+		var p jsonPair
+		p.Key, p.Key64 = encodeJSONField(k)
+		p.Value, p.Value64 = encodeJSONField(v)
+		return enc.Encode(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// LoadJSON reads a dump produced by DumpJSON into b. Like Load, it
+// writes nothing unless every line parses; see WithChunkSize.
+func LoadJSON(b Backend, r io.Reader, opts ...LoadOption) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	l := newLoader(b, opts)
+
+	for line := 1; ; line++ {
+		var p jsonPair
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBadDump, line, err)
+		}
+
+		k, err := decodeJSONField(p.Key, p.Key64)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBadDump, line, err)
+		}
+		v, err := decodeJSONField(p.Value, p.Value64)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBadDump, line, err)
+		}
+
+		if err := l.put(k, v); err != nil {
+			return err
+		}
+	}
+
+	return l.flush()
+}
@@ -0,0 +1,78 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+func TestLoadChunked(t *testing.T) {
+	src := store.NewMem()
+	defer src.Close()
+	for i := range 100 {
+		src.Put(fmt.Appendf(nil, "k%03d", i), fmt.Appendf(nil, "v%d", i))
+	}
+
+	var buf bytes.Buffer
+	if err := store.Dump(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.Bytes()
+
+	dst := store.NewMem()
+	defer dst.Close()
+	if err := store.Load(dst, bytes.NewReader(dump), store.WithChunkSize(7)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if n := dst.Len(); n != 100 {
+		t.Fatalf("Len = %d, want 100", n)
+	}
+	mustGet(t, dst, "k042", "v42")
+
+	// a damaged trailer: all or nothing by default, chunks before it
+	// otherwise
+	bad := bytes.Clone(dump)
+	bad[len(bad)-1] ^= 0xff
+
+	all := store.NewMem()
+	defer all.Close()
+	if err := store.Load(all, bytes.NewReader(bad)); !errors.Is(err, store.ErrBadDump) {
+		t.Fatalf("Load error = %v, want ErrBadDump", err)
+	}
+	if n := all.Len(); n != 0 {
+		t.Fatalf("Len after failed Load = %d, want 0", n)
+	}
+
+	chunked := store.NewMem()
+	defer chunked.Close()
+	err := store.Load(chunked, bytes.NewReader(bad), store.WithChunkSize(7))
+	if !errors.Is(err, store.ErrBadDump) {
+		t.Fatalf("chunked Load error = %v, want ErrBadDump", err)
+	}
+	if n := chunked.Len(); n != 98 {
+		t.Fatalf("Len after failed chunked Load = %d, want 98", n)
+	}
+}
+
+func TestLoadJSONChunked(t *testing.T) {
+	src := store.NewMem()
+	defer src.Close()
+	src.Put([]byte("text"), []byte("plain"))
+	src.Put([]byte{0xff, 0x00}, []byte{0xfe})
+
+	var buf bytes.Buffer
+	if err := store.DumpJSON(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := store.NewMem()
+	defer dst.Close()
+	if err := store.LoadJSON(dst, &buf, store.WithChunkSize(1)); err != nil {
+		t.Fatalf("LoadJSON: %v", err)
+	}
+	mustGet(t, dst, "text", "plain")
+	mustGet(t, dst, "\xff\x00", "\xfe")
+}
@@ -0,0 +1,591 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ Backend = (*Durable)(nil)
+	_ Batcher = (*Durable)(nil)
+)
+
+// A Durable directory holds numbered generations:
+//
+//	snap-N  Dump of the state before wal-N
+//	wal-N   log records (see Log) written since
+//
+// Reopening loads the newest snapshot and replays the WALs from its
+// generation on. Older files are deleted once a newer snapshot is safely
+// in place.
+const (
+	walPrefix  = "wal-"
+	snapPrefix = "snap-"
+	tmpSuffix  = ".tmp"
+
+	snapshotChunk = 4096 // pairs per batch when loading a snapshot
+)
+
+// SyncPolicy decides when a Durable fsyncs its WAL. Every write reaches
+// the OS before it returns, so a process crash loses nothing under any
+// policy; the policy is about power loss.
+type SyncPolicy int
+
+const (
+	SyncAlways   SyncPolicy = iota // fsync before every write returns
+	SyncInterval                   // fsync in the background, see WithSyncInterval
+	SyncNever                      // leave it to the OS
+)
+
+// DurableOption configures a Durable.
+type DurableOption func(*Durable)
+
+// WithSyncPolicy sets the fsync policy. The default is SyncInterval.
+func WithSyncPolicy(p SyncPolicy) DurableOption {
+	return func(d *Durable) { d.policy = p }
+}
+
+// WithSyncInterval sets how often SyncInterval fsyncs. The default is one
+// second.
+func WithSyncInterval(every time.Duration) DurableOption {
+	return func(d *Durable) { d.syncEvery = every }
+}
+
+// WithCheckpointInterval sets how often a snapshot is taken in the
+// background; 0 disables it. The default is five minutes.
+func WithCheckpointInterval(every time.Duration) DurableOption {
+	return func(d *Durable) { d.checkpointEvery = every }
+}
+
+// WithMemOptions configures the Mem that holds the data.
+func WithMemOptions(opts ...MemOption) DurableOption {
+	return func(d *Durable) { d.memOpts = append(d.memOpts, opts...) }
+}
+
+// Durable is a Mem whose writes are journaled to a write-ahead log in a
+// directory, with periodic full snapshots to keep the log short. Reads
+// are served by the Mem at full speed.
+type Durable struct {
+	mu     sync.Mutex // serializes writes so the WAL and m agree on order
+	m      *Mem
+	dir    string
+	wal    *os.File
+	gen    uint64
+	size   int64 // of wal
+	dirty  bool  // written since the last fsync
+	buf    []byte
+	closed bool
+
+	policy          SyncPolicy
+	syncEvery       time.Duration
+	checkpointEvery time.Duration
+	memOpts         []MemOption
+
+	cpMu     sync.Mutex // one checkpoint at a time
+	stop     chan struct{}
+	done     chan struct{}
+	recovery Recovery
+}
+
+// OpenDurable opens (or creates) the store in dir and restores its last
+// state. A torn tail of the newest WAL is cut off; see Recovery.
+func OpenDurable(dir string, opts ...DurableOption) (*Durable, error) {
+	d := &Durable{
+		dir:             dir,
+		policy:          SyncInterval,
+		syncEvery:       time.Second,
+		checkpointEvery: 5 * time.Minute,
+	}
+	for _, o := range opts {
+		o(d)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	d.m = NewMem(d.memOpts...)
+	if err := d.restore(); err != nil {
+		d.m.Close()
+		if d.wal != nil {
+			d.wal.Close()
+		}
+		return nil, err
+	}
+
+	if (d.policy == SyncInterval && d.syncEvery > 0) || d.checkpointEvery > 0 {
+		d.stop = make(chan struct{})
+		d.done = make(chan struct{})
+		go d.run()
+	}
+
+	return d, nil
+}
+
+func (d *Durable) path(prefix string, gen uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%s%016x", prefix, gen))
+}
+
+// files lists the snapshot and WAL generations in dir, ascending, and
+// clears out temporary files left by an interrupted checkpoint.
+func (d *Durable) files() (snaps, wals []uint64, err error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(filepath.Join(d.dir, name))
+			continue
+		}
+
+		for _, p := range []struct {
+			prefix string
+			list   *[]uint64
+		}{{snapPrefix, &snaps}, {walPrefix, &wals}} {
+			if !strings.HasPrefix(name, p.prefix) {
+				continue
+			}
+			if gen, err := strconv.ParseUint(name[len(p.prefix):], 16, 64); err == nil {
+				*p.list = append(*p.list, gen)
+			}
+		}
+	}
+
+	slices.Sort(snaps)
+	slices.Sort(wals)
+	return snaps, wals, nil
+}
+
+// restore loads the newest snapshot and replays the WALs after it.
+func (d *Durable) restore() error {
+	snaps, wals, err := d.files()
+	if err != nil {
+		return err
+	}
+
+	var base uint64 = 1
+	if len(snaps) > 0 {
+		base = snaps[len(snaps)-1]
+		p := d.path(snapPrefix, base)
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		// m is thrown away if this fails, so there's no need to hold the
+		// whole snapshot in memory twice
+		err = Load(d.m, f, WithChunkSize(snapshotChunk))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	var pending []uint64
+	for _, gen := range wals {
+		if gen >= base {
+			pending = append(pending, gen)
+		}
+	}
+
+	for i, gen := range pending {
+		if err := d.replay(gen, i == len(pending)-1); err != nil {
+			return err
+		}
+	}
+
+	if d.wal == nil {
+		f, err := os.OpenFile(d.path(walPrefix, base), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		d.wal, d.gen = f, base
+	}
+
+	d.removeBefore(base)
+	return nil
+}
+
+// replay applies one WAL. Only the last one may end in a torn record; it
+// is truncated and kept open for appending.
+func (d *Durable) replay(gen uint64, last bool) error {
+	p := d.path(walPrefix, gen)
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	size := fi.Size()
+
+	r := bufio.NewReader(io.NewSectionReader(f, 0, size))
+	var off int64
+
+	for {
+		op, k, v, n, err := readRecord(r, size-off)
+		if err == io.EOF {
+			break
+		}
+		if last && isTornTail(err, off, n, size) {
+			if err := d.truncate(f, off); err != nil {
+				f.Close()
+				return err
+			}
+			break
+		}
+		if err == nil {
+			err = d.apply(op, k, v)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %w at offset %d", p, err, off)
+		}
+
+		off += int64(n)
+	}
+
+	if !last {
+		return f.Close()
+	}
+
+	d.wal, d.gen, d.size = f, gen, off
+	return nil
+}
+
+// truncate cuts the torn record at off off the WAL.
+func (d *Durable) truncate(f *os.File, off int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	d.recovery = Recovery{
+		Offset:    off,
+		Discarded: countRecords(io.NewSectionReader(f, off, fi.Size()-off)),
+		Bytes:     fi.Size() - off,
+	}
+
+	if err := f.Truncate(off); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// apply replays one WAL record into m.
+func (d *Durable) apply(op byte, k, v []byte) error {
+	switch op {
+	case recPut:
+		return d.m.Put(k, v)
+	case recDel:
+		if err := d.m.Delete(k); err != nil && err != ErrNotFound {
+			return err
+		}
+		return nil
+	case recBatch:
+		var b Batch
+		r := bytes.NewReader(v)
+		for r.Len() > 0 {
+			op, k, v, _, err := readRecord(r, int64(r.Len()))
+			if err != nil || op == recBatch {
+				return ErrCorrupt
+			}
+			if op == recPut {
+				b.ops = append(b.ops, Mutation{OpPut, k, v})
+			} else {
+				b.ops = append(b.ops, Mutation{OpDelete, k, nil})
+			}
+		}
+		return d.m.Commit(&b)
+	}
+	return ErrCorrupt
+}
+
+// log appends a record to the WAL. A failed write is rolled back so a
+// partial record can't hide the ones after it. Caller must hold d.mu.
+func (d *Durable) log(rec []byte) error {
+	if _, err := d.wal.Write(rec); err != nil {
+		d.wal.Truncate(d.size)
+		return err
+	}
+	d.size += int64(len(rec))
+
+	if d.policy == SyncAlways {
+		return d.wal.Sync()
+	}
+	d.dirty = true
+	return nil
+}
+
+func (d *Durable) Put(k, v []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	d.buf = appendRecord(d.buf[:0], recPut, k, v)
+	if err := d.log(d.buf); err != nil {
+		return err
+	}
+	return d.m.Put(k, v)
+}
+
+func (d *Durable) Delete(k []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if !d.m.Exists(k) {
+		return ErrNotFound
+	}
+
+	d.buf = appendRecord(d.buf[:0], recDel, k, nil)
+	if err := d.log(d.buf); err != nil {
+		return err
+	}
+	return d.m.Delete(k)
+}
+
+// Commit journals b as one record, so after a crash either all of it or
+// none of it is replayed.
+func (d *Durable) Commit(b *Batch) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	var body []byte
+	for _, op := range b.ops {
+		switch op.Op {
+		case OpPut:
+			body = appendRecord(body, recPut, op.Key, op.Value)
+		case OpDelete:
+			body = appendRecord(body, recDel, op.Key, nil)
+		}
+	}
+
+	if err := d.log(appendRecord(nil, recBatch, nil, body)); err != nil {
+		return err
+	}
+	return d.m.Commit(b)
+}
+
+func (d *Durable) Get(k []byte) ([]byte, error) {
+	return d.m.Get(k)
+}
+
+func (d *Durable) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	return d.m.Scan(prefix, fn)
+}
+
+func (d *Durable) Range(fn func(k, v []byte) error) error {
+	return d.m.Range(fn)
+}
+
+func (d *Durable) Keys(prefix []byte) [][]byte {
+	return d.m.Keys(prefix)
+}
+
+func (d *Durable) Exists(k []byte) bool {
+	return d.m.Exists(k)
+}
+
+func (d *Durable) Len() int {
+	return d.m.Len()
+}
+
+// Snapshot returns a read-only view of the current state.
+func (d *Durable) Snapshot() *Snapshot {
+	return d.m.Snapshot()
+}
+
+// Recovery reports what was discarded when the store was opened.
+func (d *Durable) Recovery() Recovery {
+	return d.recovery
+}
+
+// Sync fsyncs the WAL.
+func (d *Durable) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if !d.dirty {
+		return nil
+	}
+
+	if err := d.wal.Sync(); err != nil {
+		return err
+	}
+	d.dirty = false
+	return nil
+}
+
+// Checkpoint writes a full snapshot and drops the WAL it covers. Writers
+// are only held up while the WAL is switched; the snapshot is written
+// from a Mem snapshot while they carry on.
+func (d *Durable) Checkpoint() error {
+	d.cpMu.Lock()
+	defer d.cpMu.Unlock()
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+
+	snap := d.m.Snapshot()
+	defer snap.Close()
+
+	next := d.gen + 1
+	f, err := os.OpenFile(d.path(walPrefix, next), os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		d.mu.Unlock()
+		return err
+	}
+
+	// until the snapshot lands, recovery still needs the old WAL whole
+	if err := d.wal.Sync(); err != nil {
+		d.mu.Unlock()
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	old := d.wal
+	d.wal, d.gen, d.size, d.dirty = f, next, 0, false
+	d.mu.Unlock()
+
+	old.Close()
+	syncDir(d.dir)
+
+	p := d.path(snapPrefix, next)
+	if err := writeSnapshot(p+tmpSuffix, snap); err != nil {
+		os.Remove(p + tmpSuffix)
+		return err
+	}
+	if err := os.Rename(p+tmpSuffix, p); err != nil {
+		os.Remove(p + tmpSuffix)
+		return err
+	}
+	syncDir(d.dir)
+
+	d.removeBefore(next)
+	return nil
+}
+
+func writeSnapshot(path string, snap *Snapshot) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	// unlike Dump, keep the schema version and other metadata
+	if err := dump(snap, f, true); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeBefore deletes the snapshots and WALs older than gen.
+func (d *Durable) removeBefore(gen uint64) {
+	snaps, wals, err := d.files()
+	if err != nil {
+		return
+	}
+
+	for _, g := range snaps {
+		if g < gen {
+			os.Remove(d.path(snapPrefix, g))
+		}
+	}
+	for _, g := range wals {
+		if g < gen {
+			os.Remove(d.path(walPrefix, g))
+		}
+	}
+}
+
+func (d *Durable) run() {
+	defer close(d.done)
+
+	var syncC, cpC <-chan time.Time
+	if d.policy == SyncInterval && d.syncEvery > 0 {
+		t := time.NewTicker(d.syncEvery)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if d.checkpointEvery > 0 {
+		t := time.NewTicker(d.checkpointEvery)
+		defer t.Stop()
+		cpC = t.C
+	}
+
+	for {
+		select {
+		case <-syncC:
+			d.Sync()
+		case <-cpC:
+			d.Checkpoint()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Close fsyncs and closes the WAL and the Mem. It doesn't take a final
+// snapshot; call Checkpoint first to make the next open faster.
+func (d *Durable) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+
+	d.closed = true
+	err := d.wal.Sync()
+	if cerr := d.wal.Close(); err == nil {
+		err = cerr
+	}
+	d.m.Close()
+	d.mu.Unlock()
+
+	// a running checkpoint needs d.mu, so wait outside the lock
+	if d.stop != nil {
+		close(d.stop)
+		<-d.done
+	}
+
+	return err
+}
@@ -0,0 +1,269 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fyrna/x/store"
+)
+
+func openDurable(t *testing.T, dir string, opts ...store.DurableOption) *store.Durable {
+	t.Helper()
+
+	opts = append([]store.DurableOption{store.WithCheckpointInterval(0)}, opts...)
+	d, err := store.OpenDurable(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// walPath and snapPath name generation gen's files in dir.
+func walPath(dir string, gen int) string {
+	return filepath.Join(dir, fmt.Sprintf("wal-%016x", gen))
+}
+
+func snapPath(dir string, gen int) string {
+	return filepath.Join(dir, fmt.Sprintf("snap-%016x", gen))
+}
+
+// dirNames lists the files in dir.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestDurableReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openDurable(t, dir)
+	d.Put([]byte("a"), []byte("1"))
+	d.Put([]byte("b"), []byte("2"))
+	d.Put([]byte("c"), []byte("3"))
+	if err := d.Delete([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	var b store.Batch
+	b.Put([]byte("a"), []byte("11"))
+	b.Put([]byte("d"), []byte("4"))
+	b.Delete([]byte("c"))
+	if err := d.Commit(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openDurable(t, dir)
+	defer d.Close()
+
+	if r := d.Recovery(); r != (store.Recovery{}) {
+		t.Fatalf("Recovery = %+v, want clean", r)
+	}
+	if n := d.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+	mustGet(t, d, "a", "11")
+	mustGet(t, d, "d", "4")
+}
+
+func TestDurableCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openDurable(t, dir)
+	d.Put([]byte("a"), []byte("1"))
+	d.Put([]byte("b"), []byte("2"))
+	if err := d.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	d.Put([]byte("c"), []byte("3"))
+	d.Delete([]byte("a"))
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first generation is gone once its snapshot replaced it
+	want := []string{filepath.Base(snapPath(dir, 2)), filepath.Base(walPath(dir, 2))}
+	if got := dirNames(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("dir holds %v, want %v", got, want)
+	}
+
+	d = openDurable(t, dir)
+	defer d.Close()
+
+	if d.Exists([]byte("a")) {
+		t.Fatal("a survived its delete")
+	}
+	mustGet(t, d, "b", "2")
+	mustGet(t, d, "c", "3")
+}
+
+func TestDurableTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openDurable(t, dir)
+	for i := range 3 {
+		d.Put(fmt.Appendf(nil, "k%02d", i), []byte("value"))
+	}
+	d.Close()
+
+	wal := walPath(dir, 1)
+	if err := os.Truncate(wal, 3*recSize-4); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openDurable(t, dir)
+	want := store.Recovery{Offset: 2 * recSize, Discarded: 1, Bytes: recSize - 4}
+	if r := d.Recovery(); r != want {
+		t.Fatalf("Recovery = %+v, want %+v", r, want)
+	}
+	if size := fileSize(t, wal); size != 2*recSize {
+		t.Fatalf("WAL is %d bytes, want %d", size, 2*recSize)
+	}
+	mustGet(t, d, "k01", "value")
+	if d.Exists([]byte("k02")) {
+		t.Fatal("torn record was applied")
+	}
+
+	// writes after the cut land on a clean boundary
+	d.Put([]byte("k03"), []byte("value"))
+	d.Close()
+
+	d = openDurable(t, dir)
+	defer d.Close()
+
+	if r := d.Recovery(); r != (store.Recovery{}) {
+		t.Fatalf("Recovery after second open = %+v, want clean", r)
+	}
+	mustGet(t, d, "k03", "value")
+}
+
+// TestDurableCheckpointCrash reopens a directory left by a checkpoint that
+// switched to a new WAL but never got its snapshot renamed into place.
+func TestDurableCheckpointCrash(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash func(t *testing.T, dir string)
+	}{
+		{"SnapshotMissing", func(t *testing.T, dir string) {
+			if err := os.Remove(snapPath(dir, 2)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"SnapshotTemp", func(t *testing.T, dir string) {
+			snap := snapPath(dir, 2)
+			// half written
+			if err := os.Truncate(snap, fileSize(t, snap)/2); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(snap, snap+".tmp"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			d := openDurable(t, dir)
+			d.Put([]byte("a"), []byte("1"))
+			d.Put([]byte("b"), []byte("2"))
+			d.Close()
+
+			// the checkpoint deletes wal-1; keep a copy to put back
+			wal1, err := os.ReadFile(walPath(dir, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d = openDurable(t, dir)
+			if err := d.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			d.Put([]byte("c"), []byte("3"))
+			d.Delete([]byte("a"))
+			d.Close()
+
+			if err := os.WriteFile(walPath(dir, 1), wal1, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tt.crash(t, dir)
+
+			d = openDurable(t, dir)
+			defer d.Close()
+
+			if d.Exists([]byte("a")) {
+				t.Fatal("a survived its delete")
+			}
+			mustGet(t, d, "b", "2")
+			mustGet(t, d, "c", "3")
+
+			for _, name := range dirNames(t, dir) {
+				if filepath.Ext(name) == ".tmp" {
+					t.Fatalf("temporary file %s left behind", name)
+				}
+			}
+		})
+	}
+}
+
+// TestDurableSyncPolicy checks that under every policy a write reaches
+// the WAL before it returns, so a second open, standing in for a restart
+// after a process crash, sees it without the first store being closed.
+func TestDurableSyncPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []store.DurableOption
+	}{
+		{"Always", []store.DurableOption{store.WithSyncPolicy(store.SyncAlways)}},
+		{"Interval", []store.DurableOption{
+			store.WithSyncPolicy(store.SyncInterval),
+			store.WithSyncInterval(time.Millisecond),
+		}},
+		{"Never", []store.DurableOption{store.WithSyncPolicy(store.SyncNever)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			d := openDurable(t, dir, tt.opts...)
+			defer d.Close()
+
+			for i := range 3 {
+				if err := d.Put(fmt.Appendf(nil, "k%02d", i), []byte("value")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if size := fileSize(t, walPath(dir, 1)); size != 3*recSize {
+				t.Fatalf("WAL is %d bytes after 3 writes, want %d", size, 3*recSize)
+			}
+			if err := d.Sync(); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+
+			crashed := openDurable(t, dir)
+			defer crashed.Close()
+
+			if n := crashed.Len(); n != 3 {
+				t.Fatalf("reopened store holds %d keys, want 3", n)
+			}
+			mustGet(t, crashed, "k02", "value")
+		})
+	}
+}
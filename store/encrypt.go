@@ -0,0 +1,433 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrDecrypt = errors.New("decryption failed")
+
+var _ Backend = (*Encrypted)(nil)
+
+// Sealed layout: version(1) | key id(4) | nonce(12) | ciphertext+tag.
+const (
+	sealVersion  = 1
+	sealOverhead = 1 + 4 + 12 + 16
+)
+
+// keyAD is the associated data for encrypted keys. Values use their
+// plaintext key instead, so a value can't be moved to another key.
+var keyAD = []byte("store/key")
+
+// EncryptOption configures an Encrypted backend.
+type EncryptOption func(*Encrypted) error
+
+// WithKeyEncryption encrypts keys as well as values. Keys are encrypted
+// deterministically (the nonce is derived from the key itself), so Get
+// and Delete still work, but equal keys are visibly equal and Scan and
+// Keys have to decrypt everything to filter by prefix.
+func WithKeyEncryption() EncryptOption {
+	return func(e *Encrypted) error {
+		e.encKeys = true
+		return nil
+	}
+}
+
+// WithOldKeys lets the backend read data sealed with earlier keys, e.g.
+// after an interrupted Rotate. New data is always sealed with the
+// current key.
+func WithOldKeys(keys ...[]byte) EncryptOption {
+	return func(e *Encrypted) error {
+		for _, k := range keys {
+			s, err := newSealer(k)
+			if err != nil {
+				return err
+			}
+			e.ring[s.id] = s
+		}
+		return nil
+	}
+}
+
+// Encrypted seals values (and optionally keys) of an inner Backend with
+// AES-GCM. Every Get verifies authenticity and fails with ErrDecrypt if
+// the stored bytes were tampered with.
+type Encrypted struct {
+	mu      sync.RWMutex // held for writing only by Rotate
+	inner   Backend
+	cur     *sealer
+	ring    map[[4]byte]*sealer
+	encKeys bool
+}
+
+// NewEncrypted wraps inner. key must be 16, 24 or 32 bytes (AES-128,
+// AES-192 or AES-256).
+func NewEncrypted(inner Backend, key []byte, opts ...EncryptOption) (*Encrypted, error) {
+	s, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Encrypted{
+		inner: inner,
+		cur:   s,
+		ring:  map[[4]byte]*sealer{s.id: s},
+	}
+	for _, o := range opts {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+type sealer struct {
+	id    [4]byte
+	aead  cipher.AEAD
+	nonce []byte // HMAC key for deterministic nonces
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sealer{aead: aead, nonce: derive(key, "store/nonce")}
+	copy(s.id[:], derive(key, "store/id"))
+	return s, nil
+}
+
+func derive(key []byte, label string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// seal encrypts plain. A nil nonce means a random one.
+func (s *sealer) seal(plain, ad, nonce []byte) []byte {
+	if nonce == nil {
+		nonce = make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			panic(err) // crypto/rand never fails on supported platforms
+		}
+	}
+
+	out := make([]byte, 0, sealOverhead+len(plain))
+	out = append(out, sealVersion)
+	out = append(out, s.id[:]...)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, plain, ad)
+}
+
+// sealKey encrypts a key deterministically.
+func (s *sealer) sealKey(k []byte) []byte {
+	h := hmac.New(sha256.New, s.nonce)
+	h.Write(k)
+	return s.seal(k, keyAD, h.Sum(nil)[:s.aead.NonceSize()])
+}
+
+// open decrypts data sealed by any key in the ring.
+func (e *Encrypted) open(data, ad []byte) ([]byte, error) {
+	if len(data) < sealOverhead || data[0] != sealVersion {
+		return nil, ErrDecrypt
+	}
+
+	s, ok := e.ring[[4]byte(data[1:5])]
+	if !ok {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := s.aead.Open(nil, data[5:17], data[17:], ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// rawKeys lists where k may be stored, current key first. Caller must
+// hold e.mu.
+func (e *Encrypted) rawKeys(k []byte) [][]byte {
+	if !e.encKeys {
+		return [][]byte{k}
+	}
+
+	out := [][]byte{e.cur.sealKey(k)}
+	for id, s := range e.ring {
+		if id != e.cur.id {
+			out = append(out, s.sealKey(k))
+		}
+	}
+	return out
+}
+
+func (e *Encrypted) Put(k, v []byte) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rks := e.rawKeys(k)
+	sealed := e.cur.seal(v, k, nil)
+	if len(rks) == 1 {
+		return e.inner.Put(rks[0], sealed)
+	}
+
+	// drop copies sealed under older keys, or a later Rotate could pick
+	// one of them over this write
+	var b Batch
+	b.Put(rks[0], sealed)
+	for _, rk := range rks[1:] {
+		b.Delete(rk)
+	}
+	return Apply(e.inner, &b)
+}
+
+func (e *Encrypted) Get(k []byte) ([]byte, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, rk := range e.rawKeys(k) {
+		v, err := e.inner.Get(rk)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return e.open(v, k)
+	}
+
+	return nil, ErrNotFound
+}
+
+func (e *Encrypted) Delete(k []byte) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	found := false
+	for _, rk := range e.rawKeys(k) {
+		err := e.inner.Delete(rk)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (e *Encrypted) Exists(k []byte) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, rk := range e.rawKeys(k) {
+		if e.inner.Exists(rk) {
+			return true
+		}
+	}
+	return false
+}
+
+// pairs decrypts every pair under prefix, in key order. Caller must hold
+// e.mu.
+func (e *Encrypted) pairs(prefix []byte) ([][2][]byte, error) {
+	var out [][2][]byte
+
+	if !e.encKeys {
+		err := e.inner.Scan(prefix, func(k, v []byte) error {
+			plain, err := e.open(v, k)
+			if err != nil {
+				return err
+			}
+			out = append(out, [2][]byte{k, plain})
+			return nil
+		})
+		return out, err
+	}
+
+	// sealed keys carry no order, so look at everything
+	seen := make(map[string]int)
+	err := e.inner.Range(func(rk, v []byte) error {
+		k, err := e.open(rk, keyAD)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+
+		// mid-rotation a key can exist under two key ids; the current
+		// one wins
+		i, dup := seen[string(k)]
+		if dup && [4]byte(rk[1:5]) != e.cur.id {
+			return nil
+		}
+
+		plain, err := e.open(v, k)
+		if err != nil {
+			return err
+		}
+
+		if dup {
+			out[i][1] = plain
+			return nil
+		}
+
+		seen[string(k)] = len(out)
+		out = append(out, [2][]byte{k, plain})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(out, func(a, b [2][]byte) int { return bytes.Compare(a[0], b[0]) })
+	return out, nil
+}
+
+func (e *Encrypted) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	e.mu.RLock()
+	out, err := e.pairs(prefix)
+	e.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range out {
+		if err := fn(p[0], p[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encrypted) Range(fn func(k, v []byte) error) error {
+	return e.Scan(nil, fn)
+}
+
+func (e *Encrypted) Keys(prefix []byte) [][]byte {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.encKeys {
+		return e.inner.Keys(prefix)
+	}
+
+	seen := make(map[string]bool)
+	var res [][]byte
+
+	for _, rk := range e.inner.Keys(nil) {
+		k, err := e.open(rk, keyAD)
+		if err != nil || !bytes.HasPrefix(k, prefix) || seen[string(k)] {
+			continue
+		}
+		seen[string(k)] = true
+		res = append(res, k)
+	}
+
+	slices.SortFunc(res, bytes.Compare)
+	return res
+}
+
+// Len reports the inner Backend's length. During an interrupted rotation
+// with key encryption a key may be counted twice.
+func (e *Encrypted) Len() int {
+	return e.inner.Len()
+}
+
+// Rotate switches to newKey and re-encrypts everything in place. The
+// rewrite is one batch, so it is atomic when the inner Backend is a
+// Batcher. Afterwards the old keys are forgotten.
+func (e *Encrypted) Rotate(newKey []byte) error {
+	next, err := newSealer(newKey)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if next.id == e.cur.id {
+		return nil
+	}
+
+	var b Batch
+	if !e.encKeys {
+		err = e.inner.Range(func(k, v []byte) error {
+			plain, err := e.open(v, k)
+			if err != nil {
+				return err
+			}
+			b.Put(k, next.seal(plain, k, nil))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		// a key can exist under several key ids; as in pairs, the copy
+		// under the current one wins
+		type kept struct {
+			plain []byte
+			cur   bool
+		}
+		keep := make(map[string]kept)
+
+		err = e.inner.Range(func(rk, v []byte) error {
+			k, err := e.open(rk, keyAD)
+			if err != nil {
+				return err
+			}
+			b.Delete(rk)
+
+			cur := [4]byte(rk[1:5]) == e.cur.id
+			if c, dup := keep[string(k)]; dup && (c.cur || !cur) {
+				return nil
+			}
+
+			plain, err := e.open(v, k)
+			if err != nil {
+				return err
+			}
+			keep[string(k)] = kept{plain, cur}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for sk, c := range keep {
+			k := []byte(sk)
+			b.Put(next.sealKey(k), next.seal(c.plain, k, nil))
+		}
+	}
+
+	if err := Apply(e.inner, &b); err != nil {
+		return err
+	}
+
+	e.cur = next
+	e.ring = map[[4]byte]*sealer{next.id: next}
+	return nil
+}
+
+func (e *Encrypted) Close() error {
+	return e.inner.Close()
+}
@@ -0,0 +1,78 @@
+package store_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+func aesKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func mustEncrypted(t *testing.T, inner store.Backend, key []byte, opts ...store.EncryptOption) *store.Encrypted {
+	t.Helper()
+
+	e, err := store.NewEncrypted(inner, key, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// TestEncryptedRotateKeepsLatest writes under an old key, overwrites under
+// a new one and rotates, for several key pairs so that the old key id
+// sorts both before and after the new one.
+func TestEncryptedRotateKeepsLatest(t *testing.T) {
+	for i := range byte(8) {
+		oldKey, newKey, nextKey := aesKey(3*i+1), aesKey(3*i+2), aesKey(3*i+3)
+
+		inner := store.NewMem()
+		e := mustEncrypted(t, inner, oldKey, store.WithKeyEncryption())
+		e.Put([]byte("k"), []byte("old"))
+
+		e = mustEncrypted(t, inner, newKey, store.WithKeyEncryption(), store.WithOldKeys(oldKey))
+		mustGet(t, e, "k", "old")
+
+		if err := e.Put([]byte("k"), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if n := inner.Len(); n != 1 {
+			t.Fatalf("pair %d: inner holds %d copies after Put, want 1", i, n)
+		}
+
+		if err := e.Rotate(nextKey); err != nil {
+			t.Fatalf("pair %d: Rotate: %v", i, err)
+		}
+		mustGet(t, e, "k", "new")
+		if n := inner.Len(); n != 1 {
+			t.Fatalf("pair %d: inner holds %d copies after Rotate, want 1", i, n)
+		}
+	}
+}
+
+// TestEncryptedRotateDuplicates rotates a store in which a key already
+// exists under both an old and the current key id.
+func TestEncryptedRotateDuplicates(t *testing.T) {
+	for i := range byte(8) {
+		oldKey, newKey, nextKey := aesKey(3*i+1), aesKey(3*i+2), aesKey(3*i+3)
+
+		inner := store.NewMem()
+		mustEncrypted(t, inner, oldKey, store.WithKeyEncryption()).Put([]byte("k"), []byte("old"))
+		// without WithOldKeys the old copy is left in place
+		mustEncrypted(t, inner, newKey, store.WithKeyEncryption()).Put([]byte("k"), []byte("new"))
+		if n := inner.Len(); n != 2 {
+			t.Fatalf("pair %d: inner holds %d copies, want 2", i, n)
+		}
+
+		e := mustEncrypted(t, inner, newKey, store.WithKeyEncryption(), store.WithOldKeys(oldKey))
+		if err := e.Rotate(nextKey); err != nil {
+			t.Fatalf("pair %d: Rotate: %v", i, err)
+		}
+		mustGet(t, e, "k", "new")
+		if n := inner.Len(); n != 1 {
+			t.Fatalf("pair %d: inner holds %d copies after Rotate, want 1", i, n)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNoIndex     = errors.New("index not found")
+	ErrIndexExists = errors.New("index already exists")
+)
+
+// Extractor returns the values a pair is indexed under; nil means the
+// pair isn't indexed. It must not modify or retain k and v.
+type Extractor func(k, v []byte) [][]byte
+
+// index maps encoded (value, key) pairs to nothing; the B-tree order
+// gives ordered scans by value, then key.
+type index struct {
+	fn Extractor
+	t  btree[struct{}]
+}
+
+// AddIndex registers a secondary index and builds it from the current
+// contents. From then on every write to m keeps it up to date under the
+// same lock.
+func (m *Mem) AddIndex(name string, fn Extractor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.indexes[name]; ok {
+		return ErrIndexExists
+	}
+
+	ix := &index{fn: fn}
+	m.t.ascend("", func(sk string, e entry) bool {
+		ix.add(sk, e.v)
+		return true
+	})
+
+	if m.indexes == nil {
+		m.indexes = make(map[string]*index)
+	}
+	m.indexes[name] = ix
+	return nil
+}
+
+// DropIndex removes an index.
+func (m *Mem) DropIndex(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.indexes[name]; !ok {
+		return ErrNoIndex
+	}
+
+	delete(m.indexes, name)
+	return nil
+}
+
+// LookupIndex returns, in order, the keys indexed under value.
+func (m *Mem) LookupIndex(name string, value []byte) ([][]byte, error) {
+	var keys [][]byte
+	err := m.scanIndex(name, indexValue(value)+indexSep, func(_, k []byte) {
+		keys = append(keys, k)
+	})
+	return keys, err
+}
+
+// ScanIndex calls fn for every (value, key) entry of the index whose
+// value starts with prefix, ordered by value and then key.
+func (m *Mem) ScanIndex(name string, prefix []byte, fn func(value, key []byte) error) error {
+	type pair struct{ v, k []byte }
+	var out []pair
+
+	err := m.scanIndex(name, indexValue(prefix), func(v, k []byte) {
+		out = append(out, pair{v, k})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range out {
+		if err := fn(p.v, p.k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mem) scanIndex(name, prefix string, fn func(v, k []byte)) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	ix, ok := m.indexes[name]
+	if !ok {
+		return ErrNoIndex
+	}
+
+	ix.t.each(prefix, false, func(ik string, _ struct{}) bool {
+		v, sk := splitIndexKey(ik)
+		if _, live := m.get(sk); live {
+			fn(v, []byte(sk))
+		}
+		return true
+	})
+	return nil
+}
+
+// reindex moves sk's index entries from its old value to its new one.
+// Caller must hold m.mu for writing.
+func (m *Mem) reindex(sk string, old []byte, hadOld bool, v []byte, hasNew bool) {
+	for _, ix := range m.indexes {
+		if hadOld {
+			ix.remove(sk, old)
+		}
+		if hasNew {
+			ix.add(sk, v)
+		}
+	}
+}
+
+func (ix *index) add(sk string, v []byte) {
+	for _, iv := range ix.fn([]byte(sk), v) {
+		ix.t.set(indexValue(iv)+indexSep+sk, struct{}{})
+	}
+}
+
+func (ix *index) remove(sk string, v []byte) {
+	for _, iv := range ix.fn([]byte(sk), v) {
+		ix.t.delete(indexValue(iv) + indexSep + sk)
+	}
+}
+
+// Index values are escaped so the separator can't occur inside them and
+// byte order is preserved: 0x00 becomes 0x00 0xff, and 0x00 0x01 ends
+// the value.
+const indexSep = "\x00\x01"
+
+func indexValue(v []byte) string {
+	return strings.ReplaceAll(string(v), "\x00", "\x00\xff")
+}
+
+func splitIndexKey(ik string) ([]byte, string) {
+	i := strings.Index(ik, indexSep)
+	v := strings.ReplaceAll(ik[:i], "\x00\xff", "\x00")
+	return []byte(v), ik[i+len(indexSep):]
+}
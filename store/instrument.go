@@ -0,0 +1,312 @@
+package store
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Backend      = (*Instrumented)(nil)
+	_ Batcher      = (*Instrumented)(nil)
+	_ RangeScanner = (*Instrumented)(nil)
+)
+
+// DefaultBuckets are the latency bucket bounds used unless WithBuckets
+// says otherwise.
+var DefaultBuckets = []time.Duration{
+	time.Microsecond, 5 * time.Microsecond,
+	10 * time.Microsecond, 50 * time.Microsecond,
+	100 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond,
+	time.Second,
+}
+
+type opKind int
+
+const (
+	opGet opKind = iota
+	opPut
+	opDelete
+	opScan
+	opRange
+	opKeys
+	opExists
+	opLen
+	opCommit
+	opScanRange
+	opCount
+)
+
+var opNames = [opCount]string{
+	"get", "put", "delete", "scan", "range", "keys", "exists", "len",
+	"commit", "scan_range",
+}
+
+// InstrumentOption configures an Instrumented backend.
+type InstrumentOption func(*Instrumented)
+
+// WithBuckets sets the latency histogram bounds. They must be ascending.
+func WithBuckets(bounds ...time.Duration) InstrumentOption {
+	return func(in *Instrumented) { in.bounds = bounds }
+}
+
+// WithTrace calls fn after every operation, e.g. to feed a tracer. fn
+// runs on the caller's goroutine and should be cheap.
+func WithTrace(fn func(op string, d time.Duration, err error)) InstrumentOption {
+	return func(in *Instrumented) { in.trace = fn }
+}
+
+// Histogram is a latency distribution.
+type Histogram struct {
+	Bounds []time.Duration `json:"bounds"` // bucket upper bounds, ascending
+	Counts []uint64        `json:"counts"` // one more than Bounds; the last is the overflow
+	Sum    time.Duration   `json:"sum"`
+}
+
+// Total is the number of observations.
+func (h Histogram) Total() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Mean is the average latency.
+func (h Histogram) Mean() time.Duration {
+	n := h.Total()
+	if n == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(n)
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th
+// quantile (0 < q <= 1). Observations in the overflow bucket report the
+// largest bound.
+func (h Histogram) Quantile(q float64) time.Duration {
+	n := h.Total()
+	if n == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(n))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, c := range h.Counts[:len(h.Bounds)] {
+		if seen += c; seen >= rank {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// OpStats are the counters of one kind of operation. ErrNotFound is
+// counted separately from other errors.
+type OpStats struct {
+	Count    uint64    `json:"count"`
+	Errors   uint64    `json:"errors"`
+	NotFound uint64    `json:"not_found"`
+	Bytes    uint64    `json:"bytes"` // value bytes written or returned
+	Latency  Histogram `json:"latency"`
+}
+
+type opMetrics struct {
+	count, errors, notFound atomic.Uint64
+	bytes, nanos            atomic.Uint64
+	buckets                 []atomic.Uint64
+}
+
+// Instrumented records per-operation counts, errors, latencies and value
+// sizes of an inner Backend. For Scan, Range and ScanRange the latency
+// includes the time spent in the callback. Commit and ScanRange go to the
+// inner Backend's own Batcher and RangeScanner when it has them, so
+// wrapping keeps batches atomic and ranges bounded.
+//
+// Instrumented implements expvar.Var, so it can be published as is:
+//
+//	expvar.Publish("store", store.NewInstrumented(m))
+type Instrumented struct {
+	inner  Backend
+	bounds []time.Duration
+	trace  func(op string, d time.Duration, err error)
+	ops    [opCount]opMetrics
+}
+
+// NewInstrumented wraps inner.
+func NewInstrumented(inner Backend, opts ...InstrumentOption) *Instrumented {
+	in := &Instrumented{inner: inner, bounds: DefaultBuckets}
+	for _, o := range opts {
+		o(in)
+	}
+
+	for i := range in.ops {
+		in.ops[i].buckets = make([]atomic.Uint64, len(in.bounds)+1)
+	}
+	return in
+}
+
+// Stats returns a copy of the counters keyed by operation name ("get",
+// "put", "delete", "scan", "range", "keys", "exists", "len", "commit",
+// "scan_range").
+func (in *Instrumented) Stats() map[string]OpStats {
+	out := make(map[string]OpStats, opCount)
+	for i := range in.ops {
+		m := &in.ops[i]
+		s := OpStats{
+			Count:    m.count.Load(),
+			Errors:   m.errors.Load(),
+			NotFound: m.notFound.Load(),
+			Bytes:    m.bytes.Load(),
+			Latency: Histogram{
+				Bounds: in.bounds,
+				Counts: make([]uint64, len(m.buckets)),
+				Sum:    time.Duration(m.nanos.Load()),
+			},
+		}
+		for j := range m.buckets {
+			s.Latency.Counts[j] = m.buckets[j].Load()
+		}
+		out[opNames[i]] = s
+	}
+	return out
+}
+
+// String renders Stats as JSON, which is what expvar expects.
+func (in *Instrumented) String() string {
+	b, err := json.Marshal(in.Stats())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// Publish registers in with expvar under name. Like expvar.Publish it
+// panics if the name is taken.
+func (in *Instrumented) Publish(name string) {
+	expvar.Publish(name, in)
+}
+
+func (in *Instrumented) record(op opKind, start time.Time, n int, err error) {
+	d := time.Since(start)
+	m := &in.ops[op]
+
+	m.count.Add(1)
+	m.bytes.Add(uint64(n))
+	m.nanos.Add(uint64(d))
+
+	switch {
+	case err == ErrNotFound:
+		m.notFound.Add(1)
+	case err != nil:
+		m.errors.Add(1)
+	}
+
+	i := 0
+	for i < len(in.bounds) && d > in.bounds[i] {
+		i++
+	}
+	m.buckets[i].Add(1)
+
+	if in.trace != nil {
+		in.trace(opNames[op], d, err)
+	}
+}
+
+func (in *Instrumented) Put(k, v []byte) error {
+	start := time.Now()
+	err := in.inner.Put(k, v)
+	in.record(opPut, start, len(v), err)
+	return err
+}
+
+func (in *Instrumented) Get(k []byte) ([]byte, error) {
+	start := time.Now()
+	v, err := in.inner.Get(k)
+	in.record(opGet, start, len(v), err)
+	return v, err
+}
+
+func (in *Instrumented) Delete(k []byte) error {
+	start := time.Now()
+	err := in.inner.Delete(k)
+	in.record(opDelete, start, 0, err)
+	return err
+}
+
+func (in *Instrumented) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	start := time.Now()
+	n := 0
+	err := in.inner.Scan(prefix, func(k, v []byte) error {
+		n += len(v)
+		return fn(k, v)
+	})
+	in.record(opScan, start, n, err)
+	return err
+}
+
+func (in *Instrumented) Range(fn func(k, v []byte) error) error {
+	start := time.Now()
+	n := 0
+	err := in.inner.Range(func(k, v []byte) error {
+		n += len(v)
+		return fn(k, v)
+	})
+	in.record(opRange, start, n, err)
+	return err
+}
+
+func (in *Instrumented) Keys(prefix []byte) [][]byte {
+	start := time.Now()
+	keys := in.inner.Keys(prefix)
+	in.record(opKeys, start, 0, nil)
+	return keys
+}
+
+func (in *Instrumented) Exists(k []byte) bool {
+	start := time.Now()
+	ok := in.inner.Exists(k)
+	in.record(opExists, start, 0, nil)
+	return ok
+}
+
+func (in *Instrumented) Len() int {
+	start := time.Now()
+	n := in.inner.Len()
+	in.record(opLen, start, 0, nil)
+	return n
+}
+
+// Commit applies b to the inner Backend; its bytes are those of the puts.
+func (in *Instrumented) Commit(b *Batch) error {
+	start := time.Now()
+	n := 0
+	for _, op := range b.ops {
+		n += len(op.Value)
+	}
+	err := Apply(in.inner, b)
+	in.record(opCommit, start, n, err)
+	return err
+}
+
+func (in *Instrumented) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	start := time.Now()
+	n := 0
+	next, err := ScanRange(in.inner, q, func(k, v []byte) error {
+		n += len(v)
+		return fn(k, v)
+	})
+	in.record(opScanRange, start, n, err)
+	return next, err
+}
+
+func (in *Instrumented) Close() error {
+	return in.inner.Close()
+}
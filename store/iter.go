@@ -0,0 +1,82 @@
+package store
+
+import "iter"
+
+// The iterators below work on a snapshot taken when iteration starts, so
+// the loop body may write to the Mem, and nothing is copied up front.
+// Every key and value handed out is a fresh copy. Iterating over a closed
+// Mem yields nothing.
+
+// All iterates over every pair in key order.
+func (m *Mem) All() iter.Seq2[[]byte, []byte] {
+	return m.Prefix(nil)
+}
+
+// Prefix iterates over the pairs whose key starts with prefix.
+func (m *Mem) Prefix(prefix []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		if s, err := m.view(); err == nil {
+			s.Prefix(prefix)(yield)
+		}
+	}
+}
+
+// Between iterates over the keys in [start, end). A nil end means no
+// upper bound.
+func (m *Mem) Between(start, end []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		if s, err := m.view(); err == nil {
+			s.Between(start, end)(yield)
+		}
+	}
+}
+
+// KeysSeq iterates over the keys starting with prefix. Unlike Keys it
+// doesn't build the whole list first.
+func (m *Mem) KeysSeq(prefix []byte) iter.Seq[[]byte] {
+	return func(yield func(k []byte) bool) {
+		if s, err := m.view(); err == nil {
+			s.KeysSeq(prefix)(yield)
+		}
+	}
+}
+
+func (s *Snapshot) All() iter.Seq2[[]byte, []byte] {
+	return s.Prefix(nil)
+}
+
+func (s *Snapshot) Prefix(prefix []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		if s.closed.Load() {
+			return
+		}
+		s.each(string(prefix), false, func(sk string, e entry) bool {
+			return yield([]byte(sk), clone(e.v))
+		})
+	}
+}
+
+func (s *Snapshot) Between(start, end []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		if s.closed.Load() {
+			return
+		}
+		s.t.ascend(string(start), func(sk string, e entry) bool {
+			if end != nil && sk >= string(end) {
+				return false
+			}
+			return e.expired(s.at) || yield([]byte(sk), clone(e.v))
+		})
+	}
+}
+
+func (s *Snapshot) KeysSeq(prefix []byte) iter.Seq[[]byte] {
+	return func(yield func(k []byte) bool) {
+		if s.closed.Load() {
+			return
+		}
+		s.each(string(prefix), false, func(sk string, _ entry) bool {
+			return yield([]byte(sk))
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrCorrupt = errors.New("corrupt log record")
+
+var _ Backend = (*Log)(nil)
+
+// record layout (little endian):
+//
+//	hcrc uint32 // castagnoli, over op, klen and vlen
+//	crc  uint32 // castagnoli, over key and val
+//	op   uint8
+//	klen uint32
+//	vlen uint32
+//	key  [klen]byte
+//	val  [vlen]byte
+//
+// The header has a checksum of its own so that a damaged length is caught
+// before it is used to size or skip the body.
+//
+// A batch record has no key; its value is a run of put/del records that
+// are replayed all together or not at all.
+const (
+	recHeader = 17
+
+	recPut   byte = 1
+	recDel   byte = 2
+	recBatch byte = 3
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// logEntry locates a live value inside the log file.
+type logEntry struct {
+	off int64
+	n   uint32
+}
+
+// Log is a file-backed Backend. Every Put and Delete is appended to a
+// checksummed log and the key index is rebuilt from it on open.
+type Log struct {
+	mu     sync.RWMutex
+	f      *os.File
+	path   string
+	idx    btree[logEntry]
+	size   int64
+	dead   int64 // bytes held by overwritten or deleted records
+	sync   bool
+	closed bool
+
+	auto       float64
+	compacting bool
+	recovery   Recovery
+}
+
+// LogOption configures a Log.
+type LogOption func(*Log)
+
+// WithSync makes every write fsync before returning.
+func WithSync(on bool) LogOption {
+	return func(l *Log) { l.sync = on }
+}
+
+// OpenLog opens (or creates) the log at path and replays it. A torn tail
+// left by a crash is truncated; see Log.Recovery.
+func OpenLog(path string, opts ...LogOption) (*Log, error) {
+	// leftover from a compaction that never reached the rename
+	os.Remove(path + compactSuffix)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		f:    f,
+		path: path,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+
+	if err := l.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// replay rebuilds the index. A torn record at the tail, left by a crash
+// mid-write, is cut off and accounted for in l.recovery; a bad record
+// anywhere else is reported, since the data after it is still good.
+func (l *Log) replay() error {
+	fi, err := l.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	r := bufio.NewReader(io.NewSectionReader(l.f, 0, size))
+	var off int64
+
+	for {
+		op, k, v, n, err := readRecord(r, size-off)
+		if err == io.EOF {
+			break
+		}
+		if isTornTail(err, off, n, size) {
+			return l.truncate(off)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w at offset %d", l.path, err, off)
+		}
+
+		if err := l.apply(op, k, v, off); err != nil {
+			return fmt.Errorf("%s: %w at offset %d", l.path, err, off)
+		}
+
+		off += int64(n)
+	}
+
+	l.size = off
+	return nil
+}
+
+// isTornTail reports whether the bad record at off is the last thing in a
+// file of the given size, as left by a crash mid-write. That is the case
+// if its header was cut short or, when the header is intact and n is the
+// record's size, if the record runs up to or past the end. A header that
+// doesn't check out only counts if nothing follows it, since its lengths
+// can't say where the record ends.
+func isTornTail(err error, off int64, n int, size int64) bool {
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		return true
+	case err != ErrCorrupt:
+		return false
+	case n == 0:
+		return off+recHeader == size
+	default:
+		return off+int64(n) == size
+	}
+}
+
+// apply updates the index for the record written at off.
+func (l *Log) apply(op byte, k, v []byte, off int64) error {
+	n := recHeader + len(k) + len(v)
+
+	switch op {
+	case recPut:
+		l.forget(string(k))
+		l.idx.set(string(k), logEntry{off + int64(n-len(v)), uint32(len(v))})
+	case recDel:
+		l.forget(string(k))
+		l.dead += int64(n)
+	case recBatch:
+		l.dead += recHeader
+		r := bytes.NewReader(v)
+		at := off + recHeader + int64(len(k))
+
+		for r.Len() > 0 {
+			op, k, v, n, err := readRecord(r, int64(r.Len()))
+			if err != nil || op == recBatch {
+				return ErrCorrupt
+			}
+			l.apply(op, k, v, at)
+			at += int64(n)
+		}
+	}
+
+	return nil
+}
+
+// forget drops sk from the index and counts its record as dead.
+func (l *Log) forget(sk string) {
+	if e, ok := l.idx.delete(sk); ok {
+		l.dead += recHeader + int64(len(sk)) + int64(e.n)
+	}
+}
+
+// truncate discards the torn record from off to the end of the file.
+func (l *Log) truncate(off int64) error {
+	fi, err := l.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	l.recovery = Recovery{
+		Offset:    off,
+		Discarded: countRecords(io.NewSectionReader(l.f, off, fi.Size()-off)),
+		Bytes:     fi.Size() - off,
+	}
+
+	if err := l.f.Truncate(off); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+
+	l.size = off
+	return nil
+}
+
+// countRecords counts the records in a discarded tail: each one whose
+// header checks out, plus any trailing fragment.
+func countRecords(r *io.SectionReader) int {
+	var (
+		h   [recHeader]byte
+		off int64
+		n   int
+	)
+
+	for off < r.Size() {
+		n++
+		if _, err := r.ReadAt(h[:], off); err != nil || !validHeader(h[:]) {
+			break
+		}
+		off += recHeader +
+			int64(binary.LittleEndian.Uint32(h[9:])) +
+			int64(binary.LittleEndian.Uint32(h[13:]))
+	}
+
+	return n
+}
+
+func validHeader(h []byte) bool {
+	return crc32.Checksum(h[8:recHeader], castagnoli) == binary.LittleEndian.Uint32(h)
+}
+
+// readRecord decodes one record from r, which has avail bytes left, and
+// returns its total size. io.EOF is only returned on a clean record
+// boundary and io.ErrUnexpectedEOF if an intact record runs past the end.
+// On ErrCorrupt, n is the record's size if its header is intact and 0
+// otherwise.
+func readRecord(r io.Reader, avail int64) (op byte, k, v []byte, n int, err error) {
+	var h [recHeader]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		return
+	}
+	if !validHeader(h[:]) {
+		err = ErrCorrupt
+		return
+	}
+
+	op = h[8]
+	klen := int64(binary.LittleEndian.Uint32(h[9:]))
+	vlen := int64(binary.LittleEndian.Uint32(h[13:]))
+
+	if klen+vlen > avail-recHeader {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	n = recHeader + int(klen+vlen)
+
+	if op != recPut && op != recDel && op != recBatch {
+		err = ErrCorrupt
+		return
+	}
+
+	body := make([]byte, klen+vlen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(h[4:]) {
+		err = ErrCorrupt
+		return
+	}
+
+	return op, body[:klen], body[klen:], n, nil
+}
+
+func appendRecord(dst []byte, op byte, k, v []byte) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0, 0, 0, 0, op)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(k)))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v)))
+	binary.LittleEndian.PutUint32(dst[start:], crc32.Checksum(dst[start+8:], castagnoli))
+
+	dst = append(dst, k...)
+	dst = append(dst, v...)
+	binary.LittleEndian.PutUint32(dst[start+4:], crc32.Checksum(dst[start+recHeader:], castagnoli))
+	return dst
+}
+
+// write appends buf at the end of the log. Caller must hold l.mu.
+func (l *Log) write(buf []byte) error {
+	if _, err := l.f.WriteAt(buf, l.size); err != nil {
+		return err
+	}
+	if l.sync {
+		if err := l.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	l.size += int64(len(buf))
+	return nil
+}
+
+func (l *Log) read(e logEntry) ([]byte, error) {
+	v := make([]byte, e.n)
+	if _, err := l.f.ReadAt(v, e.off); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (l *Log) Put(k, v []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	off := l.size
+	if err := l.write(appendRecord(nil, recPut, k, v)); err != nil {
+		return err
+	}
+
+	l.apply(recPut, k, v, off)
+	l.maybeCompact()
+	return nil
+}
+
+func (l *Log) Get(k []byte) ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return nil, ErrClosed
+	}
+
+	e, ok := l.idx.get(string(k))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return l.read(e)
+}
+
+func (l *Log) Delete(k []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	if _, ok := l.idx.get(string(k)); !ok {
+		return ErrNotFound
+	}
+
+	off := l.size
+	if err := l.write(appendRecord(nil, recDel, k, nil)); err != nil {
+		return err
+	}
+
+	l.apply(recDel, k, nil, off)
+	l.maybeCompact()
+	return nil
+}
+
+func (l *Log) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return ErrClosed
+	}
+
+	type kv struct{ k, v []byte }
+	out := make([]kv, 0, 64)
+	var err error
+
+	l.idx.each(string(prefix), false, func(sk string, e logEntry) bool {
+		var v []byte
+		if v, err = l.read(e); err != nil {
+			return false
+		}
+		out = append(out, kv{[]byte(sk), v})
+		return true
+	})
+
+	l.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range out {
+		if err := fn(e.k, e.v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Log) Range(fn func(k, v []byte) error) error {
+	return l.Scan(nil, fn)
+}
+
+func (l *Log) Keys(prefix []byte) [][]byte {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return nil
+	}
+
+	res := make([][]byte, 0, 64)
+
+	l.idx.each(string(prefix), false, func(sk string, _ logEntry) bool {
+		res = append(res, []byte(sk))
+		return true
+	})
+
+	return res
+}
+
+func (l *Log) Exists(k []byte) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return false
+	}
+
+	_, ok := l.idx.get(string(k))
+	return ok
+}
+
+func (l *Log) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return 0
+	}
+	return l.idx.Len()
+}
+
+// Sync flushes the log to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.f.Sync()
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+
+	return l.f.Close()
+}
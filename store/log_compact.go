@@ -0,0 +1,142 @@
+package store
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+const (
+	compactSuffix = ".compact"
+
+	// logs smaller than this are never compacted automatically
+	compactMinSize = 1 << 20
+)
+
+// Recovery describes what OpenLog had to throw away to get the log back
+// to a consistent state. The zero value means the log was clean.
+type Recovery struct {
+	Offset    int64 // where the torn record started
+	Discarded int   // records (or fragments) cut off
+	Bytes     int64 // bytes cut off
+}
+
+// WithAutoCompact compacts the log in the background once the fraction
+// of dead bytes reaches ratio (0 < ratio < 1). Writers block while a
+// compaction is running.
+func WithAutoCompact(ratio float64) LogOption {
+	return func(l *Log) { l.auto = ratio }
+}
+
+// Recovery reports what was discarded when the log was opened.
+func (l *Log) Recovery() Recovery {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.recovery
+}
+
+// Compact rewrites the live keys into a fresh file and atomically
+// renames it over the log.
+func (l *Log) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.compact()
+}
+
+// maybeCompact kicks off a background compaction when enough of the
+// log is dead. Caller must hold l.mu.
+func (l *Log) maybeCompact() {
+	if l.auto <= 0 || l.compacting || l.size < compactMinSize {
+		return
+	}
+	if float64(l.dead)/float64(l.size) < l.auto {
+		return
+	}
+
+	l.compacting = true
+	go func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !l.closed {
+			l.compact() // on failure the old log stays in place
+		}
+		l.compacting = false
+	}()
+}
+
+// compact does the actual rewrite. Caller must hold l.mu.
+func (l *Log) compact() error {
+	tmp := l.path + compactSuffix
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	var (
+		idx btree[logEntry]
+		w   = bufio.NewWriter(f)
+		buf []byte
+		off int64
+	)
+
+	l.idx.each("", false, func(sk string, e logEntry) bool {
+		var v []byte
+		if v, err = l.read(e); err != nil {
+			return false
+		}
+
+		buf = appendRecord(buf[:0], recPut, []byte(sk), v)
+		if _, err = w.Write(buf); err != nil {
+			return false
+		}
+
+		idx.set(sk, logEntry{off + recHeader + int64(len(sk)), e.n})
+		off += int64(len(buf))
+		return true
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fail(err)
+	}
+	syncDir(filepath.Dir(l.path))
+
+	l.f.Close()
+	l.f = f
+	l.idx = idx
+	l.size = off
+	l.dead = 0
+	return nil
+}
+
+// syncDir makes a rename durable. Not every platform supports it, so
+// errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
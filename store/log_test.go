@@ -0,0 +1,257 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+// recSize is the on-disk size of each record written by writeLog:
+// a 17-byte header, a 3-byte key and a 5-byte value.
+const recSize = 17 + 3 + 5
+
+// writeLog creates a log holding n records k00, k01, ... and returns its
+// path.
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "log")
+	l, err := store.OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		if err := l.Put(fmt.Appendf(nil, "k%02d", i), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestLogTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		keep int64 // bytes of the last record left behind
+	}{
+		{"MidHeader", 5},
+		{"MidBody", recSize - 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, 10)
+			good := int64(9 * recSize)
+			if err := os.Truncate(path, good+tt.keep); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := store.OpenLog(path)
+			if err != nil {
+				t.Fatalf("OpenLog: %v", err)
+			}
+
+			want := store.Recovery{Offset: good, Discarded: 1, Bytes: tt.keep}
+			if got := l.Recovery(); got != want {
+				t.Fatalf("Recovery = %+v, want %+v", got, want)
+			}
+			if n := l.Len(); n != 9 {
+				t.Fatalf("Len = %d, want 9", n)
+			}
+			if l.Exists([]byte("k09")) {
+				t.Fatal("torn record k09 survived")
+			}
+			if size := fileSize(t, path); size != good {
+				t.Fatalf("file size = %d, want %d", size, good)
+			}
+
+			// the log is usable again and the next open is clean
+			if err := l.Put([]byte("k09"), []byte("again")); err != nil {
+				t.Fatal(err)
+			}
+			l.Close()
+
+			l, err = store.OpenLog(path)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer l.Close()
+
+			if got := l.Recovery(); got != (store.Recovery{}) {
+				t.Fatalf("Recovery after reopen = %+v, want zero", got)
+			}
+			if v, err := l.Get([]byte("k09")); err != nil || string(v) != "again" {
+				t.Fatalf("Get(k09) = %q, %v; want again", v, err)
+			}
+		})
+	}
+}
+
+func TestLogJunkTail(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"ShortHeader", 13},
+		{"BadHeader", 17}, // lengths claiming about 8 GiB
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, 10)
+
+			junk := make([]byte, tt.size)
+			for i := range junk {
+				junk[i] = 0xff
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(junk)
+			f.Close()
+
+			l, err := store.OpenLog(path)
+			if err != nil {
+				t.Fatalf("OpenLog: %v", err)
+			}
+			defer l.Close()
+
+			want := store.Recovery{Offset: 10 * recSize, Discarded: 1, Bytes: int64(len(junk))}
+			if got := l.Recovery(); got != want {
+				t.Fatalf("Recovery = %+v, want %+v", got, want)
+			}
+			if n := l.Len(); n != 10 {
+				t.Fatalf("Len = %d, want 10", n)
+			}
+		})
+	}
+}
+
+func TestLogCorruptMiddle(t *testing.T) {
+	tests := []struct {
+		name string
+		at   int // offset into the second record
+	}{
+		{"Value", recSize - 1},
+		{"KeyLength", 12},   // high byte of klen
+		{"ValueLength", 16}, // high byte of vlen
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, 10)
+			size := fileSize(t, path)
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[recSize+tt.at] ^= 0xff
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := store.OpenLog(path)
+			if err == nil {
+				l.Close()
+				t.Fatal("OpenLog succeeded on a log corrupt mid-file")
+			}
+			if !errors.Is(err, store.ErrCorrupt) {
+				t.Fatalf("OpenLog error = %v, want ErrCorrupt", err)
+			}
+			if got := fileSize(t, path); got != size {
+				t.Fatalf("file size = %d after a failed open, want %d", got, size)
+			}
+		})
+	}
+}
+
+func TestLogCompactReopen(t *testing.T) {
+	path := writeLog(t, 10)
+
+	l, err := store.OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := l.Delete(fmt.Appendf(nil, "k%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Put([]byte("k09"), []byte("newer")); err != nil {
+		t.Fatal(err)
+	}
+
+	before := fileSize(t, path)
+	if err := l.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if after := fileSize(t, path); after >= before {
+		t.Fatalf("Compact did not shrink the log: %d -> %d bytes", before, after)
+	}
+
+	// still writable after the file was swapped
+	if err := l.Put([]byte("k10"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = store.OpenLog(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+
+	if got := l.Recovery(); got != (store.Recovery{}) {
+		t.Fatalf("Recovery = %+v, want zero", got)
+	}
+	if n := l.Len(); n != 6 {
+		t.Fatalf("Len = %d, want 6", n)
+	}
+	if l.Exists([]byte("k00")) {
+		t.Fatal("deleted key k00 came back")
+	}
+	for k, want := range map[string]string{"k05": "value", "k09": "newer", "k10": "value"} {
+		if v, err := l.Get([]byte(k)); err != nil || string(v) != want {
+			t.Fatalf("Get(%s) = %q, %v; want %q", k, v, err, want)
+		}
+	}
+}
+
+func TestLogLeftoverCompact(t *testing.T) {
+	path := writeLog(t, 3)
+	leftover := path + ".compact"
+	if err := os.WriteFile(leftover, []byte("half a compaction"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := store.OpenLog(path)
+	if err != nil {
+		t.Fatalf("OpenLog: %v", err)
+	}
+	defer l.Close()
+
+	if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("leftover %s still there: %v", leftover, err)
+	}
+	if n := l.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrSchemaTooNew = errors.New("stored schema is newer than this code")
+
+// MetaPrefix starts every key reserved for the package's own metadata.
+// Typed, Dump, DumpJSON and replication skip such keys, so they never
+// reach generic callers; the raw Backend, and so a MigrateFunc scanning
+// it, still lists them.
+const MetaPrefix = "\x00store."
+
+// SchemaKey is the reserved key holding the applied schema version,
+// encoded with EncodeInt.
+const SchemaKey = MetaPrefix + "schema"
+
+// IsMeta reports whether k is reserved for metadata.
+func IsMeta(k []byte) bool {
+	return bytes.HasPrefix(k, []byte(MetaPrefix))
+}
+
+// MigrateFunc performs one migration step. It reads from b and queues its
+// writes in batch; the step's writes and the version bump are applied
+// together.
+type MigrateFunc func(b Backend, batch *Batch) error
+
+type migration struct {
+	version int
+	name    string
+	fn      MigrateFunc
+}
+
+// Migrations is an ordered set of migration steps keyed by version. The
+// zero value is ready to use.
+type Migrations struct {
+	mu    sync.Mutex
+	steps []migration // sorted by version
+}
+
+var defaultMigrations Migrations
+
+// Register adds the step that brings the schema to version. Versions must
+// be positive and unique; Register panics otherwise, as registration
+// happens at init time.
+func (ms *Migrations) Register(version int, name string, fn MigrateFunc) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if version <= 0 {
+		panic(fmt.Sprintf("store: migration %q has version %d", name, version))
+	}
+
+	i, found := slices.BinarySearchFunc(ms.steps, version, func(m migration, v int) int {
+		return m.version - v
+	})
+	if found {
+		panic(fmt.Sprintf("store: migration version %d registered twice", version))
+	}
+
+	ms.steps = slices.Insert(ms.steps, i, migration{version, name, fn})
+}
+
+// Latest returns the highest registered version, or 0.
+func (ms *Migrations) Latest() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if len(ms.steps) == 0 {
+		return 0
+	}
+	return ms.steps[len(ms.steps)-1].version
+}
+
+// Migrate applies every step newer than b's schema version, in order.
+// Each step is committed in one batch together with the new version, so
+// it is atomic if b is a Batcher and an interrupted run resumes at the
+// failed step. Data written by a newer schema is refused with
+// ErrSchemaTooNew.
+func (ms *Migrations) Migrate(b Backend) error {
+	ms.mu.Lock()
+	steps := slices.Clone(ms.steps)
+	ms.mu.Unlock()
+
+	cur, err := SchemaVersion(b)
+	if err != nil {
+		return err
+	}
+
+	latest := 0
+	if len(steps) > 0 {
+		latest = steps[len(steps)-1].version
+	}
+	if cur > latest {
+		return fmt.Errorf("%w: stored %d, latest known %d", ErrSchemaTooNew, cur, latest)
+	}
+
+	for _, m := range steps {
+		if m.version <= cur {
+			continue
+		}
+
+		var batch Batch
+		if err := m.fn(b, &batch); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		batch.Put([]byte(SchemaKey), EncodeInt(int64(m.version)))
+
+		if err := Apply(b, &batch); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Register adds a step to the default set used by Migrate.
+func Register(version int, name string, fn MigrateFunc) {
+	defaultMigrations.Register(version, name, fn)
+}
+
+// Migrate brings b up to date with the steps added by Register.
+func Migrate(b Backend) error {
+	return defaultMigrations.Migrate(b)
+}
+
+// SchemaVersion returns b's applied schema version; 0 if none was ever
+// recorded.
+func SchemaVersion(b Backend) (int, error) {
+	v, err := b.Get([]byte(SchemaKey))
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := DecodeInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,118 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+// migrations returns a set whose single step doubles every value.
+func migrations() *store.Migrations {
+	var ms store.Migrations
+	ms.Register(1, "double", func(b store.Backend, batch *store.Batch) error {
+		return store.NewTyped[string](b, store.JSONCodec[int]{}).Range(func(k string, v int) error {
+			v2, _ := store.JSONCodec[int]{}.Encode(2 * v)
+			batch.Put([]byte(k), v2)
+			return nil
+		})
+	})
+	return &ms
+}
+
+func TestMigrateHidesSchemaKey(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+
+	typed := store.NewTyped[string](m, store.JSONCodec[int]{})
+	typed.Put("a", 1)
+	typed.Put("b", 2)
+
+	if err := migrations().Migrate(m); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if v, err := store.SchemaVersion(m); err != nil || v != 1 {
+		t.Fatalf("SchemaVersion = %d, %v; want 1", v, err)
+	}
+
+	var got []string
+	err := typed.Range(func(k string, v int) error {
+		got = append(got, fmt.Sprintf("%s=%d", k, v))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Range: %v", err)
+	}
+	if fmt.Sprint(got) != "[a=2 b=4]" {
+		t.Fatalf("Range returned %v", got)
+	}
+	if n := typed.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+	if keys := typed.Keys(""); fmt.Sprint(keys) != "[a b]" {
+		t.Fatalf("Keys = %v", keys)
+	}
+
+	var buf bytes.Buffer
+	if err := store.Dump(m, &buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := store.NewMem()
+	defer dst.Close()
+	if err := store.Load(dst, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Exists([]byte(store.SchemaKey)) || dst.Len() != 2 {
+		t.Fatalf("dump carried metadata: %d keys", dst.Len())
+	}
+
+	// running again is a no-op
+	if err := migrations().Migrate(m); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := typed.Get("a"); v != 2 {
+		t.Fatalf("a = %d after second Migrate, want 2", v)
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+	m.Put([]byte(store.SchemaKey), store.EncodeInt(5))
+
+	if err := migrations().Migrate(m); !errors.Is(err, store.ErrSchemaTooNew) {
+		t.Fatalf("Migrate error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+// TestMigrateDurable checks that a checkpoint keeps the schema version,
+// even though Dump leaves it out.
+func TestMigrateDurable(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := store.OpenDurable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Put([]byte("a"), []byte("1"))
+	if err := migrations().Migrate(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = store.OpenDurable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if v, err := store.SchemaVersion(d); err != nil || v != 1 {
+		t.Fatalf("SchemaVersion after reopen = %d, %v; want 1", v, err)
+	}
+	mustGet(t, d, "a", "2")
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"slices"
+)
+
+var ErrBadCursor = errors.New("invalid cursor")
+
+// RangeQuery selects the keys in the half-open interval [Start, End).
+type RangeQuery struct {
+	Start  []byte // inclusive; nil means from the first key
+	End    []byte // exclusive; nil means through the last key
+	Limit  int    // max pairs per call; <= 0 means no limit
+	Cursor string // resume token from a previous call; overrides Start
+}
+
+// RangeScanner is implemented by backends that can serve bounded range
+// queries in key order. next is the cursor for the following page and
+// is empty once the range is exhausted.
+type RangeScanner interface {
+	ScanRange(q RangeQuery, fn func(k, v []byte) error) (next string, err error)
+}
+
+// ScanRange runs q against b. Backends that don't implement RangeScanner
+// are served by a full Range, which is correct but not cheap.
+func ScanRange(b Backend, q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	if rs, ok := b.(RangeScanner); ok {
+		return rs.ScanRange(q, fn)
+	}
+
+	start, err := q.start()
+	if err != nil {
+		return "", err
+	}
+
+	type kv struct{ k, v []byte }
+	var out []kv
+
+	err = b.Range(func(k, v []byte) error {
+		if bytes.Compare(k, start) >= 0 && (q.End == nil || bytes.Compare(k, q.End) < 0) {
+			out = append(out, kv{k, v})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slices.SortFunc(out, func(a, b kv) int { return bytes.Compare(a.k, b.k) })
+
+	var next string
+	if q.Limit > 0 && len(out) > q.Limit {
+		next = encodeCursor(string(out[q.Limit].k))
+		out = out[:q.Limit]
+	}
+
+	for _, e := range out {
+		if err := fn(e.k, e.v); err != nil {
+			return "", err
+		}
+	}
+
+	return next, nil
+}
+
+// start resolves where the query begins.
+func (q RangeQuery) start() ([]byte, error) {
+	if q.Cursor == "" {
+		return q.Start, nil
+	}
+
+	k, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	return k, nil
+}
+
+// A cursor is simply the first key of the next page.
+func encodeCursor(k string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(k))
+}
+
+// between visits up to limit keys of t in [start, end) and returns the
+// key the next page starts at, if any.
+func (t *btree[V]) between(start, end []byte, limit int, fn func(k string, v V) bool) (next string, more bool) {
+	n := 0
+	t.ascend(string(start), func(k string, v V) bool {
+		if end != nil && k >= string(end) {
+			return false
+		}
+		if limit > 0 && n == limit {
+			next, more = k, true
+			return false
+		}
+		n++
+		return fn(k, v)
+	})
+	return
+}
+
+func (m *Mem) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	s, err := m.view()
+	if err != nil {
+		return "", err
+	}
+
+	return s.ScanRange(q, fn)
+}
+
+func (l *Log) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	start, err := q.start()
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return "", ErrClosed
+	}
+
+	type kv struct{ k, v []byte }
+	out := make([]kv, 0, 64)
+
+	next, more := l.idx.between(start, q.End, q.Limit, func(sk string, e logEntry) bool {
+		var v []byte
+		if v, err = l.read(e); err != nil {
+			return false
+		}
+		out = append(out, kv{[]byte(sk), v})
+		return true
+	})
+
+	l.mu.RUnlock()
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range out {
+		if err := fn(e.k, e.v); err != nil {
+			return "", err
+		}
+	}
+
+	if !more {
+		return "", nil
+	}
+	return encodeCursor(next), nil
+}
@@ -0,0 +1,332 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fyrna/x/store"
+)
+
+var (
+	_ store.Backend        = (*Client)(nil)
+	_ store.Batcher        = (*Client)(nil)
+	_ store.ContextBackend = (*Client)(nil)
+)
+
+// Client is a store.Backend backed by a Server. Requests are serialized
+// over a single connection. Keys, Len and Exists can't report transport
+// errors; they return nil, 0 and false instead (their Ctx variants do
+// report them).
+//
+// The *Ctx methods honour the context's deadline and cancellation. A
+// request cut short leaves the connection unusable, so it is dropped; a
+// Client made by Dial reconnects on the next request, one made by
+// NewClient returns ErrClosed from then on.
+type Client struct {
+	mu     sync.Mutex
+	dial   func() (net.Conn, error)
+	c      net.Conn // nil after a failure
+	r      *bufio.Reader
+	w      *bufio.Writer
+	buf    []byte
+	closed bool
+}
+
+// Dial connects to a Server.
+func Dial(network, addr string) (*Client, error) {
+	dial := func() (net.Conn, error) { return net.Dial(network, addr) }
+
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	cl := NewClient(c)
+	cl.dial = dial
+	return cl, nil
+}
+
+// NewClient speaks the protocol over an existing connection, which the
+// Client then owns.
+func NewClient(c net.Conn) *Client {
+	return &Client{
+		c: c,
+		r: bufio.NewReader(c),
+		w: bufio.NewWriter(c),
+	}
+}
+
+// connect makes sure there is a usable connection. Caller must hold
+// cl.mu.
+func (cl *Client) connect() error {
+	if cl.c != nil {
+		return nil
+	}
+	if cl.dial == nil {
+		return store.ErrClosed
+	}
+
+	c, err := cl.dial()
+	if err != nil {
+		return err
+	}
+
+	cl.c = c
+	cl.r = bufio.NewReader(c)
+	cl.w = bufio.NewWriter(c)
+	return nil
+}
+
+// call sends req and hands every response frame to fn until fn reports
+// it is done.
+func (cl *Client) call(ctx context.Context, req []byte, fn func(kind byte, p *parser) (done bool, err error)) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.closed {
+		return store.ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cl.connect(); err != nil {
+		return err
+	}
+
+	c := cl.c
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetDeadline(dl)
+	}
+	defer c.SetDeadline(time.Time{})
+
+	if ctx.Done() != nil {
+		// unblock any pending read or write once ctx is done
+		fired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			c.SetDeadline(time.Unix(1, 0))
+			close(fired)
+		})
+		defer func() {
+			if !stop() {
+				<-fired
+			}
+		}()
+	}
+
+	if err := writeFrame(cl.w, req); err != nil {
+		return cl.fail(ctx, err)
+	}
+	if err := cl.w.Flush(); err != nil {
+		return cl.fail(ctx, err)
+	}
+
+	for {
+		frame, err := readFrame(cl.r, cl.buf)
+		if err != nil {
+			return cl.fail(ctx, err)
+		}
+		cl.buf = frame
+
+		p := &parser{b: frame}
+		kind := p.byte()
+		if kind == respErr {
+			return decodeErr(p)
+		}
+
+		done, err := fn(kind, p)
+		if err == nil {
+			err = p.err
+		}
+		if err != nil {
+			return cl.fail(ctx, err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// fail drops the connection, which is out of sync after a transport or
+// protocol error. Caller must hold cl.mu.
+func (cl *Client) fail(ctx context.Context, err error) error {
+	cl.c.Close()
+	cl.c = nil
+
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	// the socket deadline can fire a moment before ctx notices
+	if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// single is for requests answered by exactly one respOK frame.
+func (cl *Client) single(ctx context.Context, req []byte, fn func(p *parser)) error {
+	return cl.call(ctx, req, func(kind byte, p *parser) (bool, error) {
+		if kind != respOK {
+			return true, ErrProtocol
+		}
+		if fn != nil {
+			fn(p)
+		}
+		return true, nil
+	})
+}
+
+// pairs collects a respPair stream. Callbacks run after the call returns,
+// so they may use the Client.
+func (cl *Client) pairs(ctx context.Context, req []byte) ([][2][]byte, error) {
+	var out [][2][]byte
+	err := cl.call(ctx, req, func(kind byte, p *parser) (bool, error) {
+		switch kind {
+		case respPair:
+			out = append(out, [2][]byte{p.bytes(), p.bytes()})
+			return false, nil
+		case respEnd:
+			return true, nil
+		}
+		return true, ErrProtocol
+	})
+	return out, err
+}
+
+func (cl *Client) Put(k, v []byte) error {
+	return cl.PutCtx(context.Background(), k, v)
+}
+
+func (cl *Client) PutCtx(ctx context.Context, k, v []byte) error {
+	req := appendBytes(appendBytes([]byte{opPut}, k), v)
+	return cl.single(ctx, req, nil)
+}
+
+func (cl *Client) Get(k []byte) ([]byte, error) {
+	return cl.GetCtx(context.Background(), k)
+}
+
+func (cl *Client) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	var v []byte
+	err := cl.single(ctx, appendBytes([]byte{opGet}, k), func(p *parser) {
+		v = p.bytes()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (cl *Client) Delete(k []byte) error {
+	return cl.DeleteCtx(context.Background(), k)
+}
+
+func (cl *Client) DeleteCtx(ctx context.Context, k []byte) error {
+	return cl.single(ctx, appendBytes([]byte{opDelete}, k), nil)
+}
+
+func (cl *Client) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	return cl.ScanCtx(context.Background(), prefix, fn)
+}
+
+func (cl *Client) ScanCtx(ctx context.Context, prefix []byte, fn func(k, v []byte) error) error {
+	out, err := cl.pairs(ctx, appendBytes([]byte{opScan}, prefix))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range out {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(p[0], p[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl *Client) Range(fn func(k, v []byte) error) error {
+	return cl.ScanCtx(context.Background(), nil, fn)
+}
+
+func (cl *Client) RangeCtx(ctx context.Context, fn func(k, v []byte) error) error {
+	return cl.ScanCtx(ctx, nil, fn)
+}
+
+func (cl *Client) Keys(prefix []byte) [][]byte {
+	keys, _ := cl.KeysCtx(context.Background(), prefix)
+	return keys
+}
+
+func (cl *Client) KeysCtx(ctx context.Context, prefix []byte) ([][]byte, error) {
+	out, err := cl.pairs(ctx, appendBytes([]byte{opKeys}, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, len(out))
+	for i, p := range out {
+		keys[i] = p[0]
+	}
+	return keys, nil
+}
+
+func (cl *Client) Len() int {
+	n, _ := cl.LenCtx(context.Background())
+	return n
+}
+
+func (cl *Client) LenCtx(ctx context.Context) (int, error) {
+	var n uint64
+	err := cl.single(ctx, []byte{opLen}, func(p *parser) {
+		n = p.uvarint()
+	})
+	return int(n), err
+}
+
+func (cl *Client) Exists(k []byte) bool {
+	ok, _ := cl.ExistsCtx(context.Background(), k)
+	return ok
+}
+
+func (cl *Client) ExistsCtx(ctx context.Context, k []byte) (bool, error) {
+	var ok bool
+	err := cl.single(ctx, appendBytes([]byte{opExists}, k), func(p *parser) {
+		ok = p.byte() == 1
+	})
+	return ok, err
+}
+
+// Commit sends the batch in one request. It is atomic if the server's
+// Backend is a Batcher.
+func (cl *Client) Commit(b *store.Batch) error {
+	ops := b.Mutations()
+	req := binary.AppendUvarint([]byte{opCommit}, uint64(len(ops)))
+	for _, m := range ops {
+		req = append(req, byte(m.Op))
+		req = appendBytes(req, m.Key)
+		if m.Op == store.OpPut {
+			req = appendBytes(req, m.Value)
+		}
+	}
+	return cl.single(context.Background(), req, nil)
+}
+
+// Close drops the connection. The server's Backend stays open.
+func (cl *Client) Close() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.closed {
+		return nil
+	}
+	cl.closed = true
+	if cl.c == nil {
+		return nil
+	}
+	return cl.c.Close()
+}
@@ -0,0 +1,167 @@
+package remote
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fyrna/x/store"
+)
+
+// Follower keeps a local Backend in step with the Backend behind a
+// Server. The server's Backend must implement Watcher.
+//
+// The follower first receives a full copy, which replaces the contents of
+// the local Backend in one batch, then applies every write as it
+// happens. Metadata keys (see store.IsMeta) are neither sent nor
+// replaced. If the follower falls too far behind, the server drops it and
+// Done fires; following again resynchronizes.
+type Follower struct {
+	dst    store.Backend
+	c      net.Conn
+	synced chan struct{}
+	done   chan struct{}
+	err    error
+
+	closing   atomic.Bool
+	closeOnce sync.Once
+}
+
+// Follow connects to a Server and starts mirroring it into dst.
+func Follow(network, addr string, dst store.Backend) (*Follower, error) {
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return FollowConn(c, dst)
+}
+
+// FollowConn is Follow over an existing connection, which the Follower
+// then owns.
+func FollowConn(c net.Conn, dst store.Backend) (*Follower, error) {
+	w := bufio.NewWriter(c)
+	if err := writeFrame(w, []byte{opFollow}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	f := &Follower{
+		dst:    dst,
+		c:      c,
+		synced: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Synced is closed once the initial copy has been applied.
+func (f *Follower) Synced() <-chan struct{} { return f.synced }
+
+// Done is closed when the follower stops.
+func (f *Follower) Done() <-chan struct{} { return f.done }
+
+// Err reports why the follower stopped. It is nil after Close.
+func (f *Follower) Err() error {
+	<-f.done
+	return f.err
+}
+
+// Close stops following. dst is left open.
+func (f *Follower) Close() error {
+	f.closing.Store(true)
+	f.closeOnce.Do(func() { f.c.Close() })
+	<-f.done
+	return nil
+}
+
+func (f *Follower) run() {
+	defer close(f.done)
+
+	err := f.loop()
+	if !f.closing.Load() {
+		f.err = err
+	}
+	f.closeOnce.Do(func() { f.c.Close() })
+}
+
+func (f *Follower) loop() error {
+	r := bufio.NewReader(f.c)
+
+	var (
+		buf    []byte
+		full   store.Batch
+		seen   = make(map[string]bool)
+		synced bool
+	)
+
+	for {
+		frame, err := readFrame(r, buf)
+		if err != nil {
+			return err
+		}
+		buf = frame
+
+		p := &parser{b: frame}
+		switch p.byte() {
+		case respErr:
+			return decodeErr(p)
+
+		case respPair:
+			k, v := p.bytes(), p.bytes()
+			if p.err != nil {
+				return p.err
+			}
+			if synced {
+				return ErrProtocol
+			}
+			full.Put(k, v)
+			seen[string(k)] = true
+
+		case respEnd:
+			if synced {
+				return ErrProtocol
+			}
+			for _, k := range f.dst.Keys(nil) {
+				if !seen[string(k)] && !store.IsMeta(k) {
+					full.Delete(k)
+				}
+			}
+			if err := store.Apply(f.dst, &full); err != nil {
+				return err
+			}
+			full.Reset()
+			seen, synced = nil, true
+			close(f.synced)
+
+		case respEvent:
+			op := store.Op(p.byte())
+			k, v := p.bytes(), p.bytes()
+			if p.err != nil {
+				return p.err
+			}
+
+			switch op {
+			case store.OpPut:
+				err = f.dst.Put(k, v)
+			case store.OpDelete:
+				if err = f.dst.Delete(k); err == store.ErrNotFound {
+					err = nil
+				}
+			default:
+				err = ErrProtocol
+			}
+			if err != nil {
+				return err
+			}
+
+		default:
+			return ErrProtocol
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package remote serves a store.Backend over a stream connection (TCP or
+// a Unix socket) and provides a Client that implements store.Backend on
+// the other end.
+//
+// Every message is a frame: a little endian uint32 length followed by
+// that many bytes. Requests start with an op byte, responses with a kind
+// byte; byte strings inside are uvarint length prefixed. A connection
+// carries one request at a time.
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fyrna/x/store"
+)
+
+var ErrProtocol = errors.New("remote: protocol error")
+
+// maxFrame bounds a single frame so a corrupt length can't exhaust memory.
+const maxFrame = 64 << 20
+
+// request ops
+const (
+	opGet byte = iota + 1
+	opPut
+	opDelete
+	opScan
+	opKeys
+	opLen
+	opExists
+	opCommit
+	opFollow
+)
+
+// response kinds
+const (
+	respOK    byte = iota + 1 // op-specific payload
+	respErr                   // code, message
+	respPair                  // key, value; part of a stream
+	respEnd                   // end of a stream
+	respEvent                 // op, key, value; follow only
+)
+
+// Errors that cross the wire keep their identity through a code.
+var wireErrors = []error{
+	nil,
+	store.ErrNotFound,
+	store.ErrClosed,
+	store.ErrReadOnly,
+	store.ErrNotInteger,
+}
+
+func encodeErr(buf []byte, err error) []byte {
+	code := byte(0)
+	for i, e := range wireErrors[1:] {
+		if errors.Is(err, e) {
+			code = byte(i + 1)
+			break
+		}
+	}
+
+	buf = append(buf, respErr, code)
+	return appendBytes(buf, []byte(err.Error()))
+}
+
+func decodeErr(p *parser) error {
+	code := p.byte()
+	msg := p.bytes()
+	if p.err != nil {
+		return p.err
+	}
+
+	if int(code) > 0 && int(code) < len(wireErrors) {
+		return wireErrors[code]
+	}
+	return errors.New(string(msg))
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func writeFrame(w *bufio.Writer, p []byte) error {
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(p)))
+	if _, err := w.Write(n[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(p)
+	return err
+}
+
+// readFrame reads the next frame, reusing buf when it is big enough.
+func readFrame(r *bufio.Reader, buf []byte) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(n[:])
+	if size > maxFrame {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrProtocol, size)
+	}
+
+	if cap(buf) < int(size) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parser reads fields off a frame. The first failure sticks in err and
+// later reads return zero values.
+type parser struct {
+	b   []byte
+	err error
+}
+
+func (p *parser) byte() byte {
+	if p.err != nil {
+		return 0
+	}
+	if len(p.b) == 0 {
+		p.err = fmt.Errorf("%w: short frame", ErrProtocol)
+		return 0
+	}
+
+	c := p.b[0]
+	p.b = p.b[1:]
+	return c
+}
+
+func (p *parser) uvarint() uint64 {
+	if p.err != nil {
+		return 0
+	}
+
+	n, w := binary.Uvarint(p.b)
+	if w <= 0 {
+		p.err = fmt.Errorf("%w: bad varint", ErrProtocol)
+		return 0
+	}
+	p.b = p.b[w:]
+	return n
+}
+
+// bytes returns a copy, so the frame buffer can be reused.
+func (p *parser) bytes() []byte {
+	n := p.uvarint()
+	if p.err != nil {
+		return nil
+	}
+	if uint64(len(p.b)) < n {
+		p.err = fmt.Errorf("%w: short frame", ErrProtocol)
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, p.b)
+	p.b = p.b[n:]
+	return b
+}
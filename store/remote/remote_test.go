@@ -0,0 +1,289 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fyrna/x/store"
+	"github.com/fyrna/x/store/remote"
+	"github.com/fyrna/x/store/storetest"
+)
+
+// serve starts a Server for b on a loopback port and returns its address.
+// The listener is wrapped so tests can count accepted connections.
+func serve(t *testing.T, b store.Backend) (addr string, accepted *atomic.Int32) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countingListener{Listener: l}
+
+	s := remote.NewServer(b)
+	go s.Serve(cl)
+	t.Cleanup(func() { s.Close() })
+
+	return l.Addr().String(), &cl.n
+}
+
+type countingListener struct {
+	net.Listener
+	n atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.n.Add(1)
+	}
+	return c, err
+}
+
+func dial(t *testing.T, addr string) *remote.Client {
+	t.Helper()
+
+	cl, err := remote.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func newClient(t *testing.T) store.Backend {
+	m := store.NewMem()
+	t.Cleanup(func() { m.Close() })
+
+	addr, _ := serve(t, m)
+	return dial(t, addr)
+}
+
+func TestClient(t *testing.T) {
+	storetest.RunBackendTests(t, newClient)
+}
+
+func TestClientStress(t *testing.T) {
+	storetest.RunStressTest(t, newClient)
+}
+
+// gated blocks Get of the key "slow" until open is closed.
+type gated struct {
+	*store.Mem
+	open chan struct{}
+}
+
+func (g *gated) Get(k []byte) ([]byte, error) {
+	if string(k) == "slow" {
+		<-g.open
+	}
+	return g.Mem.Get(k)
+}
+
+func newGated(t *testing.T) (*gated, string, *atomic.Int32) {
+	t.Helper()
+
+	g := &gated{Mem: store.NewMem(), open: make(chan struct{})}
+	g.Put([]byte("k"), []byte("v"))
+
+	addr, accepted := serve(t, g)
+	// registered after the server, so it runs first and lets the stuck
+	// handler finish before Close waits for it
+	t.Cleanup(func() { close(g.open) })
+	return g, addr, accepted
+}
+
+func TestClientTimeoutReconnects(t *testing.T) {
+	_, addr, accepted := newGated(t)
+	cl := dial(t, addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := cl.GetCtx(ctx, []byte("slow")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetCtx error = %v, want DeadlineExceeded", err)
+	}
+
+	// the stuck connection was dropped; the next call dials a new one
+	if v, err := cl.Get([]byte("k")); err != nil || string(v) != "v" {
+		t.Fatalf("Get after timeout = %q, %v; want v", v, err)
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Fatalf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestNewClientTimeoutCloses(t *testing.T) {
+	_, addr, _ := newGated(t)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := remote.NewClient(c)
+	defer cl.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if _, err := cl.GetCtx(ctx, []byte("slow")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetCtx error = %v, want Canceled", err)
+	}
+	if _, err := cl.Get([]byte("k")); !errors.Is(err, store.ErrClosed) {
+		t.Fatalf("Get after cancel error = %v, want ErrClosed", err)
+	}
+}
+
+// contents returns b as "k=v" strings in key order.
+func contents(b store.Backend) string {
+	var sb strings.Builder
+	b.Range(func(k, v []byte) error {
+		fmt.Fprintf(&sb, "%s=%s ", k, v)
+		return nil
+	})
+	return sb.String()
+}
+
+// eventually waits for b to hold want.
+func eventually(t *testing.T, b store.Backend, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := contents(b)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower holds %q, want %q", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	src := store.NewMem()
+	defer src.Close()
+	src.Put([]byte("a"), []byte("1"))
+	src.Put([]byte("b"), []byte("2"))
+
+	dst := store.NewMem()
+	defer dst.Close()
+	dst.Put([]byte("b"), []byte("stale"))
+	dst.Put([]byte("gone"), []byte("x"))
+
+	addr, _ := serve(t, src)
+	f, err := remote.Follow("tcp", addr, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	select {
+	case <-f.Synced():
+	case <-f.Done():
+		t.Fatalf("follower stopped: %v", f.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower never synced")
+	}
+	if got, want := contents(dst), "a=1 b=2 "; got != want {
+		t.Fatalf("after sync follower holds %q, want %q", got, want)
+	}
+
+	src.Put([]byte("c"), []byte("3"))
+	src.Delete([]byte("a"))
+	var b store.Batch
+	b.Put([]byte("b"), []byte("22"))
+	b.Put([]byte("d"), []byte("4"))
+	src.Commit(&b)
+
+	eventually(t, dst, "b=22 c=3 d=4 ")
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Err(); err != nil {
+		t.Fatalf("Err after Close = %v, want nil", err)
+	}
+}
+
+func TestFollowSkipsMeta(t *testing.T) {
+	src := store.NewMem()
+	defer src.Close()
+	src.Put([]byte("a"), []byte("1"))
+	src.Put([]byte(store.SchemaKey), store.EncodeInt(2))
+
+	dst := store.NewMem()
+	defer dst.Close()
+	dst.Put([]byte(store.SchemaKey), store.EncodeInt(1))
+
+	addr, _ := serve(t, src)
+	f, err := remote.Follow("tcp", addr, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	<-f.Synced()
+
+	src.Put([]byte(store.SchemaKey), store.EncodeInt(3))
+	src.Put([]byte("b"), []byte("2"))
+	// the follower keeps its own schema version through sync and events
+	eventually(t, dst, store.SchemaKey+"="+string(store.EncodeInt(1))+" a=1 b=2 ")
+}
+
+// stalled blocks Put until open is closed, so a follower writing into it
+// stops reading from the server.
+type stalled struct {
+	*store.Mem
+	once    sync.Once
+	blocked chan struct{}
+	open    chan struct{}
+}
+
+func (s *stalled) Put(k, v []byte) error {
+	s.once.Do(func() { close(s.blocked) })
+	<-s.open
+	return s.Mem.Put(k, v)
+}
+
+func TestFollowOverflow(t *testing.T) {
+	src := store.NewMem()
+	defer src.Close()
+
+	dst := &stalled{Mem: store.NewMem(), blocked: make(chan struct{}), open: make(chan struct{})}
+	defer dst.Close()
+
+	addr, _ := serve(t, src)
+	f, err := remote.Follow("tcp", addr, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	<-f.Synced()
+
+	// far more than the socket buffers and the server's event queue hold
+	val := make([]byte, 4096)
+	src.Put([]byte("first"), val)
+	<-dst.blocked
+	for i := range 20_000 {
+		src.Put(fmt.Appendf(nil, "k%03d", i%100), val)
+	}
+
+	close(dst.open)
+
+	select {
+	case <-f.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("follower still running after falling behind")
+	}
+	if err := f.Err(); err == nil || !strings.Contains(err.Error(), "fell behind") {
+		t.Fatalf("Err = %v, want the server's fell-behind error", err)
+	}
+}
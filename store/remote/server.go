@@ -0,0 +1,361 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/fyrna/x/store"
+)
+
+var ErrServerClosed = errors.New("remote: server closed")
+
+// Watcher is implemented by backends that can stream their writes, such
+// as store.Mem. Servers over a Watcher accept followers.
+type Watcher interface {
+	Watch(ctx context.Context, prefix []byte, opts ...store.WatchOption) (<-chan store.Event, error)
+}
+
+// followBuffer is how many events a follower may lag behind before the
+// server drops it.
+const followBuffer = 4096
+
+// Server exposes a Backend to Clients. It does not own the Backend:
+// closing the server leaves it open.
+type Server struct {
+	b store.Backend
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a server for b.
+func NewServer(b store.Backend) *Server {
+	return &Server{
+		b:         b,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on network ("tcp", "unix", ...) and addr and
+// serves until Close.
+func (s *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close, then returns
+// ErrServerClosed. l is closed on return.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(c)
+	}
+}
+
+// Close stops all listeners, drops every connection and waits for the
+// handlers to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+
+	var buf []byte
+	for {
+		frame, err := readFrame(r, buf)
+		if err != nil {
+			return
+		}
+		buf = frame
+
+		p := &parser{b: frame}
+		op := p.byte()
+
+		if op == opFollow {
+			s.follow(c, w)
+			return
+		}
+
+		if err := s.handle(op, p, w); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers one request. It only fails if the connection does.
+func (s *Server) handle(op byte, p *parser, w *bufio.Writer) error {
+	var out []byte
+
+	switch op {
+	case opGet:
+		k := p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		v, err := s.b.Get(k)
+		if err != nil {
+			return writeFrame(w, encodeErr(nil, err))
+		}
+		out = appendBytes([]byte{respOK}, v)
+
+	case opPut:
+		k, v := p.bytes(), p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		if err := s.b.Put(k, v); err != nil {
+			return writeFrame(w, encodeErr(nil, err))
+		}
+		out = []byte{respOK}
+
+	case opDelete:
+		k := p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		if err := s.b.Delete(k); err != nil {
+			return writeFrame(w, encodeErr(nil, err))
+		}
+		out = []byte{respOK}
+
+	case opScan:
+		prefix := p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		return s.stream(w, func(fn func(k, v []byte) error) error {
+			return s.b.Scan(prefix, fn)
+		})
+
+	case opKeys:
+		prefix := p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		return s.stream(w, func(fn func(k, v []byte) error) error {
+			for _, k := range s.b.Keys(prefix) {
+				if err := fn(k, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	case opLen:
+		out = binary.AppendUvarint([]byte{respOK}, uint64(s.b.Len()))
+
+	case opExists:
+		k := p.bytes()
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		out = []byte{respOK, 0}
+		if s.b.Exists(k) {
+			out[1] = 1
+		}
+
+	case opCommit:
+		var b store.Batch
+		for n := p.uvarint(); n > 0 && p.err == nil; n-- {
+			switch store.Op(p.byte()) {
+			case store.OpPut:
+				b.Put(p.bytes(), p.bytes())
+			case store.OpDelete:
+				b.Delete(p.bytes())
+			default:
+				p.err = ErrProtocol
+			}
+		}
+		if p.err != nil {
+			return writeFrame(w, encodeErr(nil, p.err))
+		}
+		if err := store.Apply(s.b, &b); err != nil {
+			return writeFrame(w, encodeErr(nil, err))
+		}
+		out = []byte{respOK}
+
+	default:
+		return writeFrame(w, encodeErr(nil, ErrProtocol))
+	}
+
+	return writeFrame(w, out)
+}
+
+// stream sends the pairs produced by scan, then respEnd or an error.
+// Pairs are written as they come, so the backend is never buffered whole.
+func (s *Server) stream(w *bufio.Writer, scan func(fn func(k, v []byte) error) error) error {
+	var (
+		out   []byte
+		wrErr error
+	)
+
+	err := scan(func(k, v []byte) error {
+		out = appendBytes(append(out[:0], respPair), k)
+		out = appendBytes(out, v)
+		if wrErr = writeFrame(w, out); wrErr != nil {
+			return wrErr
+		}
+		return nil
+	})
+	if wrErr != nil {
+		return wrErr
+	}
+	if err != nil {
+		return writeFrame(w, encodeErr(nil, err))
+	}
+	return writeFrame(w, []byte{respEnd})
+}
+
+// follow sends a full copy of the backend, then every write after it
+// until the follower hangs up. Events that raced with the copy may be
+// sent twice; replaying them in order converges on the same state.
+func (s *Server) follow(c net.Conn, w *bufio.Writer) {
+	wb, ok := s.b.(Watcher)
+	if !ok {
+		writeFrame(w, encodeErr(nil, errors.New("backend does not support watching")))
+		w.Flush()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the follower sends nothing more; a read returning means it is gone
+	go func() {
+		c.Read(make([]byte, 1))
+		cancel()
+	}()
+
+	events, err := wb.Watch(ctx, nil, store.WithBuffer(followBuffer), store.WithOverflow(store.Disconnect))
+	if err != nil {
+		writeFrame(w, encodeErr(nil, err))
+		w.Flush()
+		return
+	}
+
+	// metadata such as the schema version describes each side's own
+	// data, so it is not replicated
+	data := func(fn func(k, v []byte) error) error {
+		return s.b.Range(func(k, v []byte) error {
+			if store.IsMeta(k) {
+				return nil
+			}
+			return fn(k, v)
+		})
+	}
+	if err := s.stream(w, data); err != nil {
+		return
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	var out []byte
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				if ctx.Err() == nil {
+					writeFrame(w, encodeErr(nil, errors.New("follower fell behind")))
+					w.Flush()
+				}
+				return
+			}
+
+			if !store.IsMeta(ev.Key) {
+				out = append(out[:0], respEvent, byte(ev.Op))
+				out = appendBytes(out, ev.Key)
+				out = appendBytes(out, ev.Value)
+				if err := writeFrame(w, out); err != nil {
+					return
+				}
+			}
+
+			// batch up whatever is already queued before flushing
+			if len(events) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"bytes"
+	"container/heap"
+	"hash/maphash"
+	"iter"
+	"runtime"
+)
+
+var (
+	_ Backend = (*Sharded)(nil)
+	_ Batcher = (*Sharded)(nil)
+)
+
+// Sharded spreads keys over several independently locked Mems so that
+// writers to different keys rarely contend. Scan, Range and Keys still
+// return keys in order, merged from a snapshot of every shard taken at
+// the same instant.
+type Sharded struct {
+	shards []*Mem
+	seed   maphash.Seed
+}
+
+// NewSharded returns a store with n shards, or GOMAXPROCS shards if n is
+// not positive. opts apply to every shard.
+func NewSharded(n int, opts ...MemOption) *Sharded {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	s := &Sharded{
+		shards: make([]*Mem, n),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range s.shards {
+		s.shards[i] = NewMem(opts...)
+	}
+	return s
+}
+
+func (s *Sharded) shard(k []byte) *Mem {
+	return s.shards[maphash.Bytes(s.seed, k)%uint64(len(s.shards))]
+}
+
+func (s *Sharded) Put(k, v []byte) error {
+	return s.shard(k).Put(k, v)
+}
+
+func (s *Sharded) Get(k []byte) ([]byte, error) {
+	return s.shard(k).Get(k)
+}
+
+func (s *Sharded) Delete(k []byte) error {
+	return s.shard(k).Delete(k)
+}
+
+func (s *Sharded) Exists(k []byte) bool {
+	return s.shard(k).Exists(k)
+}
+
+// rlockAll read-locks every shard, always in the same order.
+func (s *Sharded) rlockAll() {
+	for _, m := range s.shards {
+		m.mu.RLock()
+	}
+}
+
+func (s *Sharded) runlockAll() {
+	for _, m := range s.shards {
+		m.mu.RUnlock()
+	}
+}
+
+// Len counts every shard at the same instant.
+func (s *Sharded) Len() int {
+	s.rlockAll()
+	defer s.runlockAll()
+
+	now := s.shards[0].now().UnixNano()
+	n := 0
+	for _, m := range s.shards {
+		if m.closed {
+			return 0
+		}
+		n += m.t.Len() - countExpired(&m.exp, now)
+	}
+	return n
+}
+
+// views snapshots every shard at once.
+func (s *Sharded) views() ([]*Snapshot, error) {
+	s.rlockAll()
+	defer s.runlockAll()
+
+	views := make([]*Snapshot, len(s.shards))
+	for i, m := range s.shards {
+		v, err := m.viewLocked()
+		if err != nil {
+			return nil, err
+		}
+		views[i] = v
+	}
+	return views, nil
+}
+
+func (s *Sharded) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	views, err := s.views()
+	if err != nil {
+		return err
+	}
+
+	seqs := make([]iter.Seq2[[]byte, []byte], len(views))
+	for i, v := range views {
+		seqs[i] = v.Prefix(prefix)
+	}
+
+	for k, v := range mergeSeqs(seqs) {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sharded) Range(fn func(k, v []byte) error) error {
+	return s.Scan(nil, fn)
+}
+
+func (s *Sharded) Keys(prefix []byte) [][]byte {
+	views, err := s.views()
+	if err != nil {
+		return nil
+	}
+
+	seqs := make([]iter.Seq2[[]byte, struct{}], len(views))
+	for i, v := range views {
+		seqs[i] = func(yield func([]byte, struct{}) bool) {
+			for k := range v.KeysSeq(prefix) {
+				if !yield(k, struct{}{}) {
+					return
+				}
+			}
+		}
+	}
+
+	res := make([][]byte, 0, 64)
+	for k := range mergeSeqs(seqs) {
+		res = append(res, k)
+	}
+	return res
+}
+
+// Commit applies b to all shards atomically: every shard is locked for
+// the duration.
+func (s *Sharded) Commit(b *Batch) error {
+	for _, m := range s.shards {
+		m.mu.Lock()
+	}
+	defer func() {
+		for _, m := range s.shards {
+			m.mu.Unlock()
+		}
+	}()
+
+	for _, m := range s.shards {
+		if m.closed {
+			return ErrClosed
+		}
+	}
+
+	for _, op := range b.ops {
+		m := s.shard(op.Key)
+		switch op.Op {
+		case OpPut:
+			m.put(string(op.Key), clone(op.Value), 0)
+		case OpDelete:
+			m.del(string(op.Key))
+		}
+	}
+	return nil
+}
+
+func (s *Sharded) Close() error {
+	for _, m := range s.shards {
+		m.Close()
+	}
+	return nil
+}
+
+// mergeSeqs merges sequences that are each sorted by key and have no key
+// in common.
+func mergeSeqs[V any](seqs []iter.Seq2[[]byte, V]) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		h := &mergeHeap[V]{}
+		for _, seq := range seqs {
+			next, stop := iter.Pull2(seq)
+			defer stop()
+
+			if k, v, ok := next(); ok {
+				h.items = append(h.items, mergeItem[V]{k, v, next})
+			}
+		}
+		heap.Init(h)
+
+		for len(h.items) > 0 {
+			top := &h.items[0]
+			if !yield(top.k, top.v) {
+				return
+			}
+
+			if k, v, ok := top.next(); ok {
+				top.k, top.v = k, v
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+	}
+}
+
+type mergeItem[V any] struct {
+	k    []byte
+	v    V
+	next func() ([]byte, V, bool)
+}
+
+type mergeHeap[V any] struct {
+	items []mergeItem[V]
+}
+
+func (h *mergeHeap[V]) Len() int           { return len(h.items) }
+func (h *mergeHeap[V]) Less(i, j int) bool { return bytes.Compare(h.items[i].k, h.items[j].k) < 0 }
+func (h *mergeHeap[V]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap[V]) Push(x any)         { h.items = append(h.items, x.(mergeItem[V])) }
+
+func (h *mergeHeap[V]) Pop() any {
+	n := len(h.items)
+	it := h.items[n-1]
+	h.items = h.items[:n-1]
+	return it
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrReadOnly = errors.New("snapshot is read-only")
+
+var _ Backend = (*Snapshot)(nil)
+
+// Snapshot is a read-only, point-in-time view of a Mem. Taking one is
+// O(1): the Mem copies tree nodes lazily as writers touch them, so the
+// snapshot stays consistent without blocking anyone. Keys with a TTL are
+// judged by the time the snapshot was taken. Put and Delete return
+// ErrReadOnly.
+type Snapshot struct {
+	t      btree[entry]
+	exp    btree[struct{}]
+	at     int64
+	seq    uint64
+	closed atomic.Bool
+}
+
+// Snapshot returns a view of m as it is now. Snapshots of a closed Mem
+// are closed as well.
+func (m *Mem) Snapshot() *Snapshot {
+	s, err := m.view()
+	if err != nil {
+		s = &Snapshot{}
+		s.closed.Store(true)
+	}
+	return s
+}
+
+// view returns a private snapshot of m.
+func (m *Mem) view() (*Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.viewLocked()
+}
+
+// viewLocked is view for callers already holding m.mu.
+func (m *Mem) viewLocked() (*Snapshot, error) {
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	// clone swaps the trees' copy-on-write markers, which other readers
+	// would race on
+	m.cloneMu.Lock()
+	defer m.cloneMu.Unlock()
+
+	return &Snapshot{
+		t:   m.t.clone(),
+		exp: m.exp.clone(),
+		at:  m.now().UnixNano(),
+		seq: m.seq,
+	}, nil
+}
+
+func (s *Snapshot) get(sk string) (entry, bool) {
+	e, ok := s.t.get(sk)
+	if !ok || e.expired(s.at) {
+		return entry{}, false
+	}
+	return e, true
+}
+
+// each is btree.each minus expired entries.
+func (s *Snapshot) each(prefix string, reverse bool, fn func(sk string, e entry) bool) {
+	s.t.each(prefix, reverse, func(sk string, e entry) bool {
+		return e.expired(s.at) || fn(sk, e)
+	})
+}
+
+// walk calls fn for every live pair under prefix, handing out copies.
+func (s *Snapshot) walk(prefix []byte, reverse bool, fn func(k, v []byte) error) error {
+	var err error
+	s.each(string(prefix), reverse, func(sk string, e entry) bool {
+		err = fn([]byte(sk), clone(e.v))
+		return err == nil
+	})
+	return err
+}
+
+func (s *Snapshot) Put(k, v []byte) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	return ErrReadOnly
+}
+
+func (s *Snapshot) Delete(k []byte) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	return ErrReadOnly
+}
+
+func (s *Snapshot) Get(k []byte) ([]byte, error) {
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	e, ok := s.get(string(k))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return clone(e.v), nil
+}
+
+func (s *Snapshot) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	return s.walk(prefix, false, fn)
+}
+
+func (s *Snapshot) ReverseScan(prefix []byte, fn func(k, v []byte) error) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	return s.walk(prefix, true, fn)
+}
+
+func (s *Snapshot) Range(fn func(k, v []byte) error) error {
+	return s.Scan(nil, fn)
+}
+
+func (s *Snapshot) ReverseRange(fn func(k, v []byte) error) error {
+	return s.ReverseScan(nil, fn)
+}
+
+func (s *Snapshot) ScanRange(q RangeQuery, fn func(k, v []byte) error) (string, error) {
+	if s.closed.Load() {
+		return "", ErrClosed
+	}
+
+	start, err := q.start()
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		n    int
+		next string
+		more bool
+	)
+
+	s.t.ascend(string(start), func(sk string, e entry) bool {
+		if q.End != nil && sk >= string(q.End) {
+			return false
+		}
+		if e.expired(s.at) {
+			return true
+		}
+		if q.Limit > 0 && n == q.Limit {
+			next, more = sk, true
+			return false
+		}
+
+		n++
+		err = fn([]byte(sk), clone(e.v))
+		return err == nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !more {
+		return "", nil
+	}
+	return encodeCursor(next), nil
+}
+
+func (s *Snapshot) Keys(prefix []byte) [][]byte {
+	if s.closed.Load() {
+		return nil
+	}
+
+	res := make([][]byte, 0, 64)
+	s.each(string(prefix), false, func(sk string, _ entry) bool {
+		res = append(res, []byte(sk))
+		return true
+	})
+	return res
+}
+
+func (s *Snapshot) Exists(k []byte) bool {
+	if s.closed.Load() {
+		return false
+	}
+
+	_, ok := s.get(string(k))
+	return ok
+}
+
+func (s *Snapshot) Len() int {
+	if s.closed.Load() {
+		return 0
+	}
+	return s.t.Len() - countExpired(&s.exp, s.at)
+}
+
+func (s *Snapshot) Close() error {
+	s.closed.Store(true)
+	return nil
+}
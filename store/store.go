@@ -2,8 +2,8 @@ package store
 
 import (
 	"errors"
-	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -24,16 +24,47 @@ type Backend interface {
 	Close() error
 }
 
-// Mem is an in-memory Backend implementation.
+// Mem is an in-memory Backend implementation. Keys are kept in byte
+// order, so Scan, Range and Keys return them sorted.
 type Mem struct {
-	mu     sync.RWMutex
-	m      map[string][]byte
-	closed bool
+	mu      sync.RWMutex
+	cloneMu sync.Mutex // serializes clones taken under a read lock
+	t       btree[entry]
+	exp     btree[struct{}] // expKey(exp, key) for every key with a TTL
+	seq     uint64          // bumped on every write
+	closed  bool
+
+	now   func() time.Time
+	sweep time.Duration
+	stop  chan struct{} // non-nil once the sweeper runs
+	done  chan struct{}
+
+	watchers map[*watcher]struct{}
+	indexes  map[string]*index
+}
+
+// entry is a stored value, the sequence number of its last write and,
+// if it has a TTL, when it expires (unix nanoseconds).
+type entry struct {
+	v   []byte
+	ver uint64
+	exp int64
+}
+
+func (e entry) expired(now int64) bool {
+	return e.exp != 0 && e.exp <= now
 }
 
 // NewMem returns a fresh in-memory store.
-func NewMem() *Mem {
-	return &Mem{m: make(map[string][]byte)}
+func NewMem(opts ...MemOption) *Mem {
+	m := &Mem{
+		now:   time.Now,
+		sweep: time.Second,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
 }
 
 func clone(b []byte) []byte {
@@ -45,6 +76,54 @@ func clone(b []byte) []byte {
 	return c
 }
 
+// put and del are the only places the tree is written. Caller must hold
+// m.mu for writing.
+func (m *Mem) put(sk string, v []byte, exp int64) {
+	m.seq++
+	old, ok := m.t.set(sk, entry{v, m.seq, exp})
+
+	if ok && old.exp != 0 {
+		m.exp.delete(expKey(old.exp, sk))
+	}
+	if exp != 0 {
+		m.exp.set(expKey(exp, sk), struct{}{})
+	}
+	if len(m.indexes) > 0 {
+		m.reindex(sk, old.v, ok, v, true)
+	}
+	if len(m.watchers) > 0 {
+		m.notify(OpPut, sk, v)
+	}
+}
+
+func (m *Mem) del(sk string) bool {
+	old, ok := m.t.delete(sk)
+	if !ok {
+		return false
+	}
+
+	if old.exp != 0 {
+		m.exp.delete(expKey(old.exp, sk))
+	}
+	if len(m.indexes) > 0 {
+		m.reindex(sk, old.v, true, nil, false)
+	}
+	if len(m.watchers) > 0 {
+		m.notify(OpDelete, sk, nil)
+	}
+	m.seq++
+	return true
+}
+
+// get looks sk up, hiding expired entries. Caller must hold m.mu.
+func (m *Mem) get(sk string) (entry, bool) {
+	e, ok := m.t.get(sk)
+	if !ok || e.expired(m.now().UnixNano()) {
+		return entry{}, false
+	}
+	return e, true
+}
+
 func (m *Mem) Put(k, v []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -53,7 +132,7 @@ func (m *Mem) Put(k, v []byte) error {
 		return ErrClosed
 	}
 
-	m.m[string(k)] = clone(v)
+	m.put(string(k), clone(v), 0)
 	return nil
 }
 
@@ -65,12 +144,12 @@ func (m *Mem) Get(k []byte) ([]byte, error) {
 		return nil, ErrClosed
 	}
 
-	v, ok := m.m[string(k)]
+	e, ok := m.get(string(k))
 	if !ok {
 		return nil, ErrNotFound
 	}
 
-	return clone(v), nil
+	return clone(e.v), nil
 }
 
 func (m *Mem) Delete(k []byte) error {
@@ -82,66 +161,40 @@ func (m *Mem) Delete(k []byte) error {
 	}
 
 	sk := string(k)
-	if _, ok := m.m[sk]; !ok {
+	_, live := m.get(sk)
+	if !m.del(sk) || !live {
 		return ErrNotFound
 	}
 
-	delete(m.m, sk)
 	return nil
 }
 
 func (m *Mem) Scan(prefix []byte, fn func(k, v []byte) error) error {
-	m.mu.RLock()
-	if m.closed {
-		m.mu.RUnlock()
-		return ErrClosed
-	}
-
-	type kv struct{ k, v []byte }
-	ps := string(prefix)
-	out := make([]kv, 0, 64)
-
-	for sk, v := range m.m {
-		if !strings.HasPrefix(sk, ps) {
-			continue
-		}
-		out = append(out, kv{[]byte(sk), clone(v)})
-	}
-
-	m.mu.RUnlock()
-
-	for _, e := range out {
-		if err := fn(e.k, e.v); err != nil {
-			return err
-		}
-	}
+	return m.scan(prefix, false, fn)
+}
 
-	return nil
+// ReverseScan is like Scan but visits keys in descending order.
+func (m *Mem) ReverseScan(prefix []byte, fn func(k, v []byte) error) error {
+	return m.scan(prefix, true, fn)
 }
 
 func (m *Mem) Range(fn func(k, v []byte) error) error {
-	m.mu.RLock()
-	if m.closed {
-		m.mu.RUnlock()
-		return ErrClosed
-	}
-
-	type kv struct{ k, v []byte }
-	out := make([]kv, 0, len(m.m))
-
-	for sk, v := range m.m {
-		out = append(out, kv{[]byte(sk), clone(v)})
-	}
+	return m.scan(nil, false, fn)
+}
 
-	m.mu.RUnlock()
+// ReverseRange is like Range but visits keys in descending order.
+func (m *Mem) ReverseRange(fn func(k, v []byte) error) error {
+	return m.scan(nil, true, fn)
+}
 
-	for _, e := range out {
-		if err := fn(e.k, e.v); err != nil {
-			return err
-		}
+// scan walks a private snapshot, so fn may freely call back into m.
+func (m *Mem) scan(prefix []byte, reverse bool, fn func(k, v []byte) error) error {
+	s, err := m.view()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.walk(prefix, reverse, fn)
 }
 
 func (m *Mem) Keys(prefix []byte) [][]byte {
@@ -152,14 +205,15 @@ func (m *Mem) Keys(prefix []byte) [][]byte {
 		return nil
 	}
 
-	ps := string(prefix)
 	res := make([][]byte, 0, 64)
+	now := m.now().UnixNano()
 
-	for sk := range m.m {
-		if strings.HasPrefix(sk, ps) {
+	m.t.each(string(prefix), false, func(sk string, e entry) bool {
+		if !e.expired(now) {
 			res = append(res, []byte(sk))
 		}
-	}
+		return true
+	})
 
 	return res
 }
@@ -168,7 +222,11 @@ func (m *Mem) Exists(k []byte) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	_, ok := m.m[string(k)]
+	if m.closed {
+		return false
+	}
+
+	_, ok := m.get(string(k))
 	return ok
 }
 
@@ -176,17 +234,33 @@ func (m *Mem) Len() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return len(m.m)
+	if m.closed {
+		return 0
+	}
+	return m.t.Len() - countExpired(&m.exp, m.now().UnixNano())
 }
 
 func (m *Mem) Close() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	if m.closed {
+		m.mu.Unlock()
 		return nil
 	}
 
 	m.closed = true
+	for w := range m.watchers {
+		m.unwatch(w)
+	}
+
+	stop, done := m.stop, m.done
+	m.mu.Unlock()
+
+	// the sweeper takes m.mu, so wait for it outside the lock
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
 	return nil
 }
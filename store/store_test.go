@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fyrna/x/store"
+	"github.com/fyrna/x/store/storetest"
+)
+
+var backends = []struct {
+	name string
+	new  storetest.Factory
+}{
+	{"Mem", func(t *testing.T) store.Backend {
+		return store.NewMem()
+	}},
+	{"Log", func(t *testing.T) store.Backend {
+		l, err := store.OpenLog(filepath.Join(t.TempDir(), "log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}},
+	{"Sharded", func(t *testing.T) store.Backend {
+		return store.NewSharded(4)
+	}},
+	{"Durable", func(t *testing.T) store.Backend {
+		d, err := store.OpenDurable(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}},
+}
+
+func TestBackends(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			storetest.RunBackendTests(t, b.new)
+		})
+	}
+}
+
+func TestBackendsStress(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			storetest.RunStressTest(t, b.new)
+		})
+	}
+}
+
+func BenchmarkMem(b *testing.B) {
+	storetest.RunBenchmarks(b, func(b *testing.B) store.Backend {
+		return store.NewMem()
+	})
+}
+
+func BenchmarkSharded(b *testing.B) {
+	storetest.RunBenchmarks(b, func(b *testing.B) store.Backend {
+		return store.NewSharded(0)
+	})
+}
@@ -0,0 +1,138 @@
+package storetest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+// BenchFactory returns a new, empty Backend for a benchmark.
+type BenchFactory func(b *testing.B) store.Backend
+
+// benchKeys is the size of the key space the benchmarks work on.
+const benchKeys = 1 << 14
+
+func benchKey(i int) []byte {
+	return fmt.Appendf(nil, "key/%08d", i%benchKeys)
+}
+
+// RunBenchmarks runs a set of sub-benchmarks against backends made by
+// newBackend. Call it from several Benchmark functions to compare
+// backends, e.g.
+//
+//	func BenchmarkMem(b *testing.B) {
+//		storetest.RunBenchmarks(b, func(b *testing.B) store.Backend {
+//			return store.NewMem()
+//		})
+//	}
+//
+//	func BenchmarkSharded(b *testing.B) {
+//		storetest.RunBenchmarks(b, func(b *testing.B) store.Backend {
+//			return store.NewSharded(0)
+//		})
+//	}
+func RunBenchmarks(b *testing.B, newBackend BenchFactory) {
+	b.Run("Put", func(b *testing.B) { benchPut(b, newBackend) })
+	b.Run("Get", func(b *testing.B) { benchGet(b, newBackend) })
+	b.Run("ParallelPut", func(b *testing.B) { benchParallel(b, newBackend, 100) })
+	b.Run("ParallelMixed", func(b *testing.B) { benchParallel(b, newBackend, 20) })
+	b.Run("ParallelGet", func(b *testing.B) { benchParallel(b, newBackend, 0) })
+	b.Run("Scan", func(b *testing.B) { benchScan(b, newBackend) })
+}
+
+func fill(b *testing.B, be store.Backend) {
+	b.Helper()
+	val := make([]byte, 64)
+	for i := range benchKeys {
+		if err := be.Put(benchKey(i), val); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchPut(b *testing.B, newBackend BenchFactory) {
+	be := newBackend(b)
+	defer be.Close()
+
+	val := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; b.Loop(); i++ {
+		if err := be.Put(benchKey(i), val); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchGet(b *testing.B, newBackend BenchFactory) {
+	be := newBackend(b)
+	defer be.Close()
+	fill(b, be)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; b.Loop(); i++ {
+		if _, err := be.Get(benchKey(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchParallel runs goroutines doing writePct percent writes and reads
+// otherwise, on random keys.
+func benchParallel(b *testing.B, newBackend BenchFactory, writePct int) {
+	be := newBackend(b)
+	defer be.Close()
+	fill(b, be)
+
+	var failed atomic.Bool
+	val := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		for pb.Next() {
+			k := benchKey(r.IntN(benchKeys))
+
+			var err error
+			if r.IntN(100) < writePct {
+				err = be.Put(k, val)
+			} else {
+				_, err = be.Get(k)
+			}
+			if err != nil {
+				failed.Store(true)
+			}
+		}
+	})
+
+	if failed.Load() {
+		b.Fatal("operation failed")
+	}
+}
+
+func benchScan(b *testing.B, newBackend BenchFactory) {
+	be := newBackend(b)
+	defer be.Close()
+	fill(b, be)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		n := 0
+		err := be.Range(func(k, v []byte) error {
+			n++
+			return nil
+		})
+		if err != nil || n != benchKeys {
+			b.Fatalf("Range: %d pairs, %v", n, err)
+		}
+	}
+}
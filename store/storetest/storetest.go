@@ -0,0 +1,404 @@
+// Package storetest checks that a store.Backend behaves like the ones in
+// package store. A new backend only needs a factory:
+//
+//	func TestMyBackend(t *testing.T) {
+//		storetest.RunBackendTests(t, func(t *testing.T) store.Backend {
+//			return mybackend.New(t.TempDir())
+//		})
+//	}
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+// Factory returns a new, empty Backend. The suite closes it.
+type Factory func(t *testing.T) store.Backend
+
+// RunBackendTests runs the conformance suite against fresh backends made
+// by newBackend, one per subtest.
+func RunBackendTests(t *testing.T, newBackend Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b store.Backend)
+	}{
+		{"PutGet", testPutGet},
+		{"Overwrite", testOverwrite},
+		{"EmptyAndBinary", testEmptyAndBinary},
+		{"CloneOnRead", testCloneOnRead},
+		{"CloneOnWrite", testCloneOnWrite},
+		{"Delete", testDelete},
+		{"ExistsLen", testExistsLen},
+		{"Scan", testScan},
+		{"ScanError", testScanError},
+		{"Keys", testKeys},
+		{"Close", testClose},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackend(t)
+			t.Cleanup(func() { b.Close() })
+			tt.fn(t, b)
+		})
+	}
+}
+
+func mustPut(t *testing.T, b store.Backend, k, v string) {
+	t.Helper()
+	if err := b.Put([]byte(k), []byte(v)); err != nil {
+		t.Fatalf("Put(%q): %v", k, err)
+	}
+}
+
+func mustGet(t *testing.T, b store.Backend, k, want string) {
+	t.Helper()
+	v, err := b.Get([]byte(k))
+	if err != nil {
+		t.Fatalf("Get(%q): %v", k, err)
+	}
+	if string(v) != want {
+		t.Fatalf("Get(%q) = %q, want %q", k, v, want)
+	}
+}
+
+func testPutGet(t *testing.T, b store.Backend) {
+	mustPut(t, b, "a", "1")
+	mustPut(t, b, "b", "2")
+	mustGet(t, b, "a", "1")
+	mustGet(t, b, "b", "2")
+
+	if _, err := b.Get([]byte("missing")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testOverwrite(t *testing.T, b store.Backend) {
+	mustPut(t, b, "k", "old")
+	mustPut(t, b, "k", "new")
+	mustGet(t, b, "k", "new")
+
+	if n := b.Len(); n != 1 {
+		t.Fatalf("Len after overwrite = %d, want 1", n)
+	}
+}
+
+func testEmptyAndBinary(t *testing.T, b store.Backend) {
+	mustPut(t, b, "empty", "")
+	mustGet(t, b, "empty", "")
+
+	k := []byte{0x00, 0xff, 0x01, 0x00}
+	v := []byte{0xff, 0x00, 0xfe}
+	if err := b.Put(k, v); err != nil {
+		t.Fatalf("Put(binary): %v", err)
+	}
+
+	got, err := b.Get(k)
+	if err != nil || !bytes.Equal(got, v) {
+		t.Fatalf("Get(binary) = %x, %v; want %x", got, err, v)
+	}
+}
+
+func testCloneOnRead(t *testing.T, b store.Backend) {
+	mustPut(t, b, "k", "value")
+
+	v, _ := b.Get([]byte("k"))
+	if len(v) > 0 {
+		v[0] = 'X'
+	}
+	mustGet(t, b, "k", "value")
+
+	b.Scan(nil, func(k, v []byte) error {
+		if len(v) > 0 {
+			v[0] = 'X'
+		}
+		if len(k) > 0 {
+			k[0] = 'X'
+		}
+		return nil
+	})
+	mustGet(t, b, "k", "value")
+
+	for _, k := range b.Keys(nil) {
+		if len(k) > 0 {
+			k[0] = 'X'
+		}
+	}
+	mustGet(t, b, "k", "value")
+}
+
+func testCloneOnWrite(t *testing.T, b store.Backend) {
+	k, v := []byte("k"), []byte("value")
+	if err := b.Put(k, v); err != nil {
+		t.Fatal(err)
+	}
+	v[0] = 'X'
+	k[0] = 'X'
+
+	mustGet(t, b, "k", "value")
+}
+
+func testDelete(t *testing.T, b store.Backend) {
+	if err := b.Delete([]byte("missing")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Delete(missing) error = %v, want ErrNotFound", err)
+	}
+
+	mustPut(t, b, "k", "v")
+	if err := b.Delete([]byte("k")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Get([]byte("k")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := b.Delete([]byte("k")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testExistsLen(t *testing.T, b store.Backend) {
+	if n := b.Len(); n != 0 {
+		t.Fatalf("Len of new backend = %d, want 0", n)
+	}
+
+	for i := range 10 {
+		mustPut(t, b, fmt.Sprintf("k%02d", i), "v")
+	}
+	if n := b.Len(); n != 10 {
+		t.Fatalf("Len = %d, want 10", n)
+	}
+	if !b.Exists([]byte("k03")) {
+		t.Fatal("Exists(k03) = false")
+	}
+	if b.Exists([]byte("k10")) {
+		t.Fatal("Exists(k10) = true")
+	}
+
+	b.Delete([]byte("k03"))
+	if b.Exists([]byte("k03")) {
+		t.Fatal("Exists after Delete = true")
+	}
+	if n := b.Len(); n != 9 {
+		t.Fatalf("Len after Delete = %d, want 9", n)
+	}
+}
+
+// collect returns "k=v" for every pair, sorted, so unordered backends
+// pass too.
+func collect(t *testing.T, scan func(fn func(k, v []byte) error) error) []string {
+	t.Helper()
+
+	var out []string
+	err := scan(func(k, v []byte) error {
+		out = append(out, string(k)+"="+string(v))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	slices.Sort(out)
+	return out
+}
+
+func testScan(t *testing.T, b store.Backend) {
+	mustPut(t, b, "a/1", "x")
+	mustPut(t, b, "a/2", "y")
+	mustPut(t, b, "b/1", "z")
+	mustPut(t, b, "a", "root")
+
+	got := collect(t, func(fn func(k, v []byte) error) error {
+		return b.Scan([]byte("a/"), fn)
+	})
+	if want := []string{"a/1=x", "a/2=y"}; !slices.Equal(got, want) {
+		t.Fatalf("Scan(a/) = %v, want %v", got, want)
+	}
+
+	got = collect(t, b.Range)
+	if want := []string{"a/1=x", "a/2=y", "a=root", "b/1=z"}; !slices.Equal(got, want) {
+		t.Fatalf("Range = %v, want %v", got, want)
+	}
+
+	got = collect(t, func(fn func(k, v []byte) error) error {
+		return b.Scan([]byte("nothing"), fn)
+	})
+	if len(got) != 0 {
+		t.Fatalf("Scan(nothing) = %v, want none", got)
+	}
+}
+
+func testScanError(t *testing.T, b store.Backend) {
+	for i := range 5 {
+		mustPut(t, b, fmt.Sprint(i), "v")
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := b.Range(func(k, v []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Range error = %v, want the callback's", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Range called fn %d times after an error, want 1", calls)
+	}
+}
+
+func testKeys(t *testing.T, b store.Backend) {
+	mustPut(t, b, "x/1", "")
+	mustPut(t, b, "x/2", "")
+	mustPut(t, b, "y/1", "")
+
+	var got []string
+	for _, k := range b.Keys([]byte("x/")) {
+		got = append(got, string(k))
+	}
+	slices.Sort(got)
+	if want := []string{"x/1", "x/2"}; !slices.Equal(got, want) {
+		t.Fatalf("Keys(x/) = %v, want %v", got, want)
+	}
+
+	if n := len(b.Keys(nil)); n != 3 {
+		t.Fatalf("len(Keys(nil)) = %d, want 3", n)
+	}
+}
+
+func testClose(t *testing.T, b store.Backend) {
+	mustPut(t, b, "k", "v")
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if err := b.Put([]byte("k"), []byte("v")); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("Put after Close error = %v, want ErrClosed", err)
+	}
+	if _, err := b.Get([]byte("k")); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("Get after Close error = %v, want ErrClosed", err)
+	}
+	if err := b.Delete([]byte("k")); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("Delete after Close error = %v, want ErrClosed", err)
+	}
+	if err := b.Range(func(k, v []byte) error { return nil }); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("Range after Close error = %v, want ErrClosed", err)
+	}
+	if keys := b.Keys(nil); len(keys) != 0 {
+		t.Errorf("Keys after Close = %q, want none", keys)
+	}
+	if b.Exists([]byte("k")) {
+		t.Error("Exists after Close = true")
+	}
+	if n := b.Len(); n != 0 {
+		t.Errorf("Len after Close = %d, want 0", n)
+	}
+}
+
+// RunStressTest hammers one Backend from many goroutines. Each goroutine
+// owns a set of keys and checks at the end that they hold what it last
+// wrote; all of them also read and scan a shared key space. Run it with
+// -race.
+func RunStressTest(t *testing.T, newBackend Factory) {
+	const (
+		workers = 8
+		ops     = 500
+		keys    = 32
+	)
+
+	b := newBackend(t)
+	t.Cleanup(func() { b.Close() })
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- stress(b, w, ops, keys)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func stress(b store.Backend, w, ops, keys int) error {
+	want := make(map[string]string)
+
+	for i := range ops {
+		k := fmt.Sprintf("w%d/%03d", w, i%keys)
+		shared := []byte(fmt.Sprintf("shared/%03d", i%keys))
+
+		switch i % 7 {
+		case 0, 1, 2:
+			v := fmt.Sprintf("%d.%d", w, i)
+			if err := b.Put([]byte(k), []byte(v)); err != nil {
+				return fmt.Errorf("worker %d: Put: %w", w, err)
+			}
+			want[k] = v
+		case 3:
+			err := b.Delete([]byte(k))
+			_, ok := want[k]
+			if ok && err != nil {
+				return fmt.Errorf("worker %d: Delete: %w", w, err)
+			}
+			if !ok && !errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("worker %d: Delete(missing) error = %v", w, err)
+			}
+			delete(want, k)
+		case 4:
+			if err := b.Put(shared, []byte(k)); err != nil {
+				return fmt.Errorf("worker %d: Put(shared): %w", w, err)
+			}
+		case 5:
+			if _, err := b.Get(shared); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("worker %d: Get(shared): %w", w, err)
+			}
+		case 6:
+			prefix := []byte(fmt.Sprintf("w%d/", w))
+			n := 0
+			err := b.Scan(prefix, func(k, v []byte) error {
+				if !bytes.HasPrefix(k, prefix) {
+					return fmt.Errorf("key %q outside prefix %q", k, prefix)
+				}
+				n++
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("worker %d: Scan: %w", w, err)
+			}
+			if n != len(want) {
+				return fmt.Errorf("worker %d: Scan saw %d keys, want %d", w, n, len(want))
+			}
+		}
+	}
+
+	for k, v := range want {
+		got, err := b.Get([]byte(k))
+		if err != nil || string(got) != v {
+			return fmt.Errorf("worker %d: Get(%q) = %q, %v; want %q", w, k, got, err, v)
+		}
+	}
+
+	n := len(b.Keys([]byte(fmt.Sprintf("w%d/", w))))
+	if n != len(want) {
+		return fmt.Errorf("worker %d: Keys found %d, want %d", w, n, len(want))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// MemOption configures a Mem.
+type MemOption func(*Mem)
+
+// WithClock replaces time.Now as the source of time for expiry.
+func WithClock(now func() time.Time) MemOption {
+	return func(m *Mem) { m.now = now }
+}
+
+// WithSweepInterval sets how often expired keys are reclaimed in the
+// background. The default is one second.
+func WithSweepInterval(d time.Duration) MemOption {
+	return func(m *Mem) { m.sweep = d }
+}
+
+// PutWithTTL stores v under k and expires it after ttl. Expired keys are
+// invisible right away and reclaimed by a background sweeper, which is
+// started on first use and stopped by Close. A ttl <= 0 behaves like Put.
+func (m *Mem) PutWithTTL(k, v []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	var exp int64
+	if ttl > 0 {
+		exp = m.now().Add(ttl).UnixNano()
+		m.startSweeper()
+	}
+
+	m.put(string(k), clone(v), exp)
+	return nil
+}
+
+// TTL returns how long k has left to live, or 0 if it never expires.
+func (m *Mem) TTL(k []byte) (time.Duration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	e, ok := m.get(string(k))
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if e.exp == 0 {
+		return 0, nil
+	}
+
+	return time.Duration(e.exp - m.now().UnixNano()), nil
+}
+
+// Sweep reclaims expired keys now and reports how many it removed.
+func (m *Mem) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return 0
+	}
+
+	var dead []string
+	now := m.now().UnixNano()
+
+	m.exp.ascend("", func(ek string, _ struct{}) bool {
+		exp, sk := splitExpKey(ek)
+		if exp > now {
+			return false
+		}
+		dead = append(dead, sk)
+		return true
+	})
+
+	for _, sk := range dead {
+		m.del(sk)
+	}
+
+	return len(dead)
+}
+
+// startSweeper launches the background sweeper once. Caller must hold
+// m.mu.
+func (m *Mem) startSweeper() {
+	if m.stop != nil || m.sweep <= 0 {
+		return
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		t := time.NewTicker(m.sweep)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				m.Sweep()
+			}
+		}
+	}(m.stop, m.done)
+}
+
+// expKey orders the expiry index by time, then key.
+func expKey(exp int64, sk string) string {
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(sk)), uint64(exp))
+	return string(append(b, sk...))
+}
+
+func splitExpKey(ek string) (int64, string) {
+	return int64(binary.BigEndian.Uint64([]byte(ek[:8]))), ek[8:]
+}
+
+// countExpired counts the entries of an expiry index that are due.
+func countExpired(t *btree[struct{}], now int64) int {
+	n := 0
+	t.ascend("", func(ek string, _ struct{}) bool {
+		if exp, _ := splitExpKey(ek); exp > now {
+			return false
+		}
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,186 @@
+package store_test
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fyrna/x/store"
+)
+
+// fakeClock is a clock for WithClock that only moves when told to.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newTTLMem returns a Mem on clk whose sweeper never runs on its own.
+func newTTLMem(clk *fakeClock) *store.Mem {
+	return store.NewMem(store.WithClock(clk.Now), store.WithSweepInterval(0))
+}
+
+func TestTTLExpiryIsHidden(t *testing.T) {
+	clk := newFakeClock()
+	m := newTTLMem(clk)
+	defer m.Close()
+
+	m.Put([]byte("k/keep"), []byte("v"))
+	m.PutWithTTL([]byte("k/gone"), []byte("v"), time.Minute)
+
+	clk.Advance(time.Minute - time.Nanosecond)
+	if !m.Exists([]byte("k/gone")) {
+		t.Fatal("key expired early")
+	}
+
+	clk.Advance(time.Nanosecond)
+
+	if _, err := m.Get([]byte("k/gone")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get after expiry error = %v, want ErrNotFound", err)
+	}
+	if m.Exists([]byte("k/gone")) {
+		t.Error("Exists after expiry = true")
+	}
+	if n := m.Len(); n != 1 {
+		t.Errorf("Len after expiry = %d, want 1", n)
+	}
+	if keys := m.Keys([]byte("k/")); len(keys) != 1 || string(keys[0]) != "k/keep" {
+		t.Errorf("Keys after expiry = %q, want [k/keep]", keys)
+	}
+
+	var seen []string
+	m.Scan([]byte("k/"), func(k, v []byte) error {
+		seen = append(seen, string(k))
+		return nil
+	})
+	if len(seen) != 1 || seen[0] != "k/keep" {
+		t.Errorf("Scan after expiry saw %q, want [k/keep]", seen)
+	}
+}
+
+func TestTTLSweep(t *testing.T) {
+	clk := newFakeClock()
+	m := newTTLMem(clk)
+	defer m.Close()
+
+	m.PutWithTTL([]byte("a"), nil, time.Second)
+	m.PutWithTTL([]byte("b"), nil, 2*time.Second)
+	m.PutWithTTL([]byte("c"), nil, time.Hour)
+	m.Put([]byte("d"), nil)
+
+	if n := m.Sweep(); n != 0 {
+		t.Fatalf("Sweep before expiry removed %d", n)
+	}
+
+	clk.Advance(2 * time.Second)
+	if n := m.Sweep(); n != 2 {
+		t.Fatalf("Sweep removed %d, want 2", n)
+	}
+	if n := m.Sweep(); n != 0 {
+		t.Fatalf("second Sweep removed %d, want 0", n)
+	}
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+}
+
+func TestTTLOverwrite(t *testing.T) {
+	clk := newFakeClock()
+	m := newTTLMem(clk)
+	defer m.Close()
+
+	m.PutWithTTL([]byte("k"), []byte("1"), time.Minute)
+	clk.Advance(20 * time.Second)
+
+	if d, err := m.TTL([]byte("k")); err != nil || d != 40*time.Second {
+		t.Fatalf("TTL = %v, %v; want 40s", d, err)
+	}
+
+	m.PutWithTTL([]byte("k"), []byte("2"), time.Hour)
+	if d, _ := m.TTL([]byte("k")); d != time.Hour {
+		t.Fatalf("TTL after PutWithTTL = %v, want 1h", d)
+	}
+
+	// a plain Put clears the expiry
+	m.Put([]byte("k"), []byte("3"))
+	if d, err := m.TTL([]byte("k")); err != nil || d != 0 {
+		t.Fatalf("TTL after Put = %v, %v; want 0", d, err)
+	}
+
+	clk.Advance(2 * time.Hour)
+	if n := m.Sweep(); n != 0 {
+		t.Fatalf("Sweep removed %d keys, want 0", n)
+	}
+	mustGet(t, m, "k", "3")
+
+	if _, err := m.TTL([]byte("missing")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("TTL(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTTLSnapshot(t *testing.T) {
+	clk := newFakeClock()
+	m := newTTLMem(clk)
+	defer m.Close()
+
+	m.PutWithTTL([]byte("k"), []byte("v"), time.Minute)
+	s := m.Snapshot()
+	defer s.Close()
+
+	clk.Advance(time.Hour)
+
+	if m.Exists([]byte("k")) {
+		t.Fatal("Mem still has the expired key")
+	}
+	if _, err := s.Get([]byte("k")); err != nil {
+		t.Fatalf("Snapshot.Get: %v; want the value alive when the snapshot was taken", err)
+	}
+	if n := s.Len(); n != 1 {
+		t.Fatalf("Snapshot.Len = %d, want 1", n)
+	}
+
+	late := m.Snapshot()
+	defer late.Close()
+	if late.Exists([]byte("k")) {
+		t.Fatal("a snapshot taken after expiry has the key")
+	}
+}
+
+func TestTTLCloseStopsSweeper(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	clk := newFakeClock()
+	m := store.NewMem(store.WithClock(clk.Now), store.WithSweepInterval(time.Millisecond))
+	m.PutWithTTL([]byte("k"), nil, time.Second)
+
+	if runtime.NumGoroutine() <= before {
+		t.Fatal("PutWithTTL did not start a sweeper")
+	}
+
+	m.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines after Close, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
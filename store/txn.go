@@ -0,0 +1,232 @@
+package store
+
+import "errors"
+
+var (
+	ErrConflict = errors.New("transaction conflict")
+	ErrTxnDone  = errors.New("transaction already finished")
+)
+
+// Txn is an optimistic read-write transaction on a Mem. Reads see a
+// snapshot taken at Begin plus the transaction's own writes, which are
+// staged until Commit. Commit fails with ErrConflict if any key the
+// transaction read (or any prefix it scanned) changed in the meantime.
+//
+// A Txn is not safe for concurrent use.
+type Txn struct {
+	m    *Mem
+	snap *Snapshot
+
+	reads  map[string]uint64 // version seen, 0 if absent
+	scans  map[string]int    // prefix -> keys seen
+	writes btree[txnWrite]
+	done   bool
+}
+
+type txnWrite struct {
+	v   []byte
+	del bool
+}
+
+// Begin starts a transaction.
+func (m *Mem) Begin() (*Txn, error) {
+	s, err := m.view()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Txn{
+		m:     m,
+		snap:  s,
+		reads: make(map[string]uint64),
+		scans: make(map[string]int),
+	}, nil
+}
+
+// Update runs fn in a transaction and commits it, starting over with a
+// fresh transaction for as long as the commit conflicts.
+func (m *Mem) Update(fn func(tx *Txn) error) error {
+	for {
+		tx, err := m.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != ErrConflict {
+			return err
+		}
+	}
+}
+
+func (tx *Txn) Get(k []byte) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxnDone
+	}
+
+	v, ok := tx.lookup(string(k))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return clone(v), nil
+}
+
+// lookup reads sk through the staged writes, recording snapshot reads.
+func (tx *Txn) lookup(sk string) ([]byte, bool) {
+	if w, ok := tx.writes.get(sk); ok {
+		return w.v, !w.del
+	}
+
+	e, ok := tx.snap.get(sk)
+	if _, seen := tx.reads[sk]; !seen {
+		tx.reads[sk] = e.ver
+	}
+	return e.v, ok
+}
+
+func (tx *Txn) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	if tx.done {
+		return ErrTxnDone
+	}
+
+	type kv struct {
+		k   string
+		v   []byte
+		del bool
+	}
+
+	ps := string(prefix)
+	var base, staged []kv
+
+	tx.snap.each(ps, false, func(sk string, e entry) bool {
+		base = append(base, kv{sk, e.v, false})
+		return true
+	})
+	tx.scans[ps] = len(base)
+
+	tx.writes.each(ps, false, func(sk string, w txnWrite) bool {
+		staged = append(staged, kv{sk, w.v, w.del})
+		return true
+	})
+
+	// merge the two sorted runs; staged writes win
+	for len(base) > 0 || len(staged) > 0 {
+		var e kv
+		switch {
+		case len(staged) == 0 || (len(base) > 0 && base[0].k < staged[0].k):
+			e, base = base[0], base[1:]
+		case len(base) == 0 || staged[0].k < base[0].k:
+			e, staged = staged[0], staged[1:]
+		default:
+			e, base, staged = staged[0], base[1:], staged[1:]
+		}
+
+		if e.del {
+			continue
+		}
+		if err := fn([]byte(e.k), clone(e.v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tx *Txn) Put(k, v []byte) error {
+	if tx.done {
+		return ErrTxnDone
+	}
+
+	tx.writes.set(string(k), txnWrite{v: clone(v)})
+	return nil
+}
+
+func (tx *Txn) Delete(k []byte) error {
+	if tx.done {
+		return ErrTxnDone
+	}
+
+	sk := string(k)
+	if _, ok := tx.lookup(sk); !ok {
+		return ErrNotFound
+	}
+
+	tx.writes.set(sk, txnWrite{del: true})
+	return nil
+}
+
+// Commit applies the staged writes atomically, or returns ErrConflict and
+// applies nothing. The transaction is finished either way.
+func (tx *Txn) Commit() error {
+	if tx.done {
+		return ErrTxnDone
+	}
+	tx.done = true
+
+	m := tx.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if !tx.valid() {
+		return ErrConflict
+	}
+
+	tx.writes.each("", false, func(sk string, w txnWrite) bool {
+		if w.del {
+			m.del(sk)
+		} else {
+			m.put(sk, w.v, 0)
+		}
+		return true
+	})
+
+	return nil
+}
+
+// Rollback discards the transaction. It is safe to call after Commit.
+func (tx *Txn) Rollback() {
+	tx.done = true
+	tx.snap = nil
+	tx.writes = btree[txnWrite]{}
+}
+
+// valid reports whether everything tx read is still current. Caller must
+// hold tx.m.mu.
+func (tx *Txn) valid() bool {
+	m, seq := tx.m, tx.snap.seq
+	if m.seq == seq && m.exp.Len() == 0 {
+		return true
+	}
+
+	for sk, ver := range tx.reads {
+		if e, _ := m.get(sk); e.ver != ver {
+			return false
+		}
+	}
+
+	now := m.now().UnixNano()
+	for p, n := range tx.scans {
+		ok, seen := true, 0
+		m.t.each(p, false, func(_ string, e entry) bool {
+			if e.expired(now) {
+				return true
+			}
+			seen++
+			ok = e.ver <= seq
+			return ok
+		})
+		if !ok || seen != n {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,212 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fyrna/x/store"
+)
+
+func mustGet(t *testing.T, b store.Backend, k, want string) {
+	t.Helper()
+
+	v, err := b.Get([]byte(k))
+	if err != nil {
+		t.Fatalf("Get(%s): %v", k, err)
+	}
+	if string(v) != want {
+		t.Fatalf("Get(%s) = %q, want %q", k, v, want)
+	}
+}
+
+func mustBegin(t *testing.T, m *store.Mem) *store.Txn {
+	t.Helper()
+
+	tx, err := m.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTxnCommit(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+	m.Put([]byte("a"), []byte("1"))
+
+	tx := mustBegin(t, m)
+	if v, err := tx.Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Fatalf("tx.Get(a) = %q, %v", v, err)
+	}
+	tx.Put([]byte("b"), []byte("2"))
+	tx.Delete([]byte("a"))
+
+	// staged writes are visible inside, not outside
+	if v, err := tx.Get([]byte("b")); err != nil || string(v) != "2" {
+		t.Fatalf("tx.Get(b) = %q, %v", v, err)
+	}
+	if m.Exists([]byte("b")) {
+		t.Fatal("staged write visible before Commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	mustGet(t, m, "b", "2")
+	if m.Exists([]byte("a")) {
+		t.Fatal("deleted key a still there")
+	}
+
+	if err := tx.Commit(); !errors.Is(err, store.ErrTxnDone) {
+		t.Fatalf("second Commit error = %v, want ErrTxnDone", err)
+	}
+}
+
+func TestTxnReadConflict(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+	m.Put([]byte("a"), []byte("1"))
+
+	tx := mustBegin(t, m)
+	tx.Get([]byte("a"))
+	tx.Put([]byte("b"), []byte("from tx"))
+
+	m.Put([]byte("a"), []byte("2"))
+
+	if err := tx.Commit(); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("Commit error = %v, want ErrConflict", err)
+	}
+	if m.Exists([]byte("b")) {
+		t.Fatal("conflicting transaction applied a write")
+	}
+}
+
+func TestTxnReadAbsentConflict(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+
+	tx := mustBegin(t, m)
+	if _, err := tx.Get([]byte("a")); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("tx.Get(a) error = %v, want ErrNotFound", err)
+	}
+	tx.Put([]byte("b"), []byte("from tx"))
+
+	m.Put([]byte("a"), []byte("appeared"))
+
+	if err := tx.Commit(); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("Commit error = %v, want ErrConflict", err)
+	}
+}
+
+func TestTxnPhantom(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(m *store.Mem)
+		conflict bool
+	}{
+		{"Insert", func(m *store.Mem) { m.Put([]byte("p/2"), nil) }, true},
+		{"Delete", func(m *store.Mem) { m.Delete([]byte("p/1")) }, true},
+		{"Overwrite", func(m *store.Mem) { m.Put([]byte("p/1"), []byte("y")) }, true},
+		{"OutsidePrefix", func(m *store.Mem) { m.Put([]byte("q/1"), nil) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := store.NewMem()
+			defer m.Close()
+			m.Put([]byte("p/1"), []byte("x"))
+
+			tx := mustBegin(t, m)
+			n := 0
+			tx.Scan([]byte("p/"), func(k, v []byte) error {
+				n++
+				return nil
+			})
+			if n != 1 {
+				t.Fatalf("Scan saw %d keys, want 1", n)
+			}
+			tx.Put([]byte("count"), []byte{byte(n)})
+
+			tt.write(m)
+
+			err := tx.Commit()
+			if tt.conflict && !errors.Is(err, store.ErrConflict) {
+				t.Fatalf("Commit error = %v, want ErrConflict", err)
+			}
+			if !tt.conflict && err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+		})
+	}
+}
+
+func TestTxnBlindWrite(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+	m.Put([]byte("a"), []byte("1"))
+
+	tx := mustBegin(t, m)
+	tx.Put([]byte("a"), []byte("from tx"))
+
+	m.Put([]byte("a"), []byte("2"))
+	m.Put([]byte("b"), []byte("2"))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit of blind write: %v", err)
+	}
+	mustGet(t, m, "a", "from tx")
+}
+
+func TestTxnUpdateRetries(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+	m.Put([]byte("n"), store.EncodeInt(1))
+
+	attempts := 0
+	err := m.Update(func(tx *store.Txn) error {
+		attempts++
+
+		v, err := tx.Get([]byte("n"))
+		if err != nil {
+			return err
+		}
+		n, err := store.DecodeInt(v)
+		if err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			// someone else gets in between the read and the commit
+			m.Put([]byte("n"), store.EncodeInt(10))
+		}
+		return tx.Put([]byte("n"), store.EncodeInt(n+1))
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("Update ran fn %d times, want 2", attempts)
+	}
+
+	v, _ := m.Get([]byte("n"))
+	if n, _ := store.DecodeInt(v); n != 11 {
+		t.Fatalf("n = %d, want 11", n)
+	}
+}
+
+func TestTxnUpdateError(t *testing.T) {
+	m := store.NewMem()
+	defer m.Close()
+
+	stop := errors.New("stop")
+	err := m.Update(func(tx *store.Txn) error {
+		tx.Put([]byte("a"), []byte("1"))
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Update error = %v, want fn's", err)
+	}
+	if m.Exists([]byte("a")) {
+		t.Fatal("failed Update applied a write")
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec converts values to bytes and back.
+type Codec[V any] interface {
+	Encode(v V) ([]byte, error)
+	Decode(b []byte) (V, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Encode(v V) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec[V]) Decode(b []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob. Every value carries its own
+// type information, so it is bulkier than JSON for small values.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Encode(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) Decode(b []byte) (V, error) {
+	var v V
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// RawCodec passes bytes through untouched.
+type RawCodec struct{}
+
+func (RawCodec) Encode(v []byte) ([]byte, error) { return v, nil }
+func (RawCodec) Decode(b []byte) ([]byte, error) { return b, nil }
+
+// Key is what Typed accepts as a key.
+type Key interface {
+	~string | ~[]byte
+}
+
+// Typed wraps a Backend with real Go types for keys and values.
+type Typed[K Key, V any] struct {
+	b     Backend
+	codec Codec[V]
+}
+
+// NewTyped returns a typed view of b using codec for values.
+func NewTyped[K Key, V any](b Backend, codec Codec[V]) *Typed[K, V] {
+	return &Typed[K, V]{b: b, codec: codec}
+}
+
+// Backend returns the underlying Backend.
+func (t *Typed[K, V]) Backend() Backend { return t.b }
+
+// Get returns the value for k. A missing key yields the zero V and an
+// error matching ErrNotFound.
+func (t *Typed[K, V]) Get(k K) (V, error) {
+	var zero V
+
+	b, err := t.b.Get([]byte(k))
+	if err != nil {
+		return zero, err
+	}
+
+	v, err := t.codec.Decode(b)
+	if err != nil {
+		return zero, fmt.Errorf("decode %q: %w", k, err)
+	}
+	return v, nil
+}
+
+// Lookup is Get with a found flag instead of ErrNotFound.
+func (t *Typed[K, V]) Lookup(k K) (V, bool, error) {
+	v, err := t.Get(k)
+	if errors.Is(err, ErrNotFound) {
+		return v, false, nil
+	}
+	return v, err == nil, err
+}
+
+// GetOr returns the value for k, or def if k doesn't exist.
+func (t *Typed[K, V]) GetOr(k K, def V) (V, error) {
+	v, ok, err := t.Lookup(k)
+	if !ok && err == nil {
+		return def, nil
+	}
+	return v, err
+}
+
+func (t *Typed[K, V]) Put(k K, v V) error {
+	b, err := t.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode %q: %w", k, err)
+	}
+	return t.b.Put([]byte(k), b)
+}
+
+func (t *Typed[K, V]) Delete(k K) error {
+	return t.b.Delete([]byte(k))
+}
+
+func (t *Typed[K, V]) Exists(k K) bool {
+	return t.b.Exists([]byte(k))
+}
+
+func (t *Typed[K, V]) Scan(prefix K, fn func(k K, v V) error) error {
+	return t.b.Scan([]byte(prefix), func(kb, vb []byte) error {
+		if IsMeta(kb) {
+			return nil
+		}
+		v, err := t.codec.Decode(vb)
+		if err != nil {
+			return fmt.Errorf("decode %q: %w", kb, err)
+		}
+		return fn(K(kb), v)
+	})
+}
+
+func (t *Typed[K, V]) Range(fn func(k K, v V) error) error {
+	var none K
+	return t.Scan(none, fn)
+}
+
+func (t *Typed[K, V]) Keys(prefix K) []K {
+	raw := t.b.Keys([]byte(prefix))
+	res := make([]K, 0, len(raw))
+	for _, k := range raw {
+		if !IsMeta(k) {
+			res = append(res, K(k))
+		}
+	}
+	return res
+}
+
+// Len reports the number of keys, not counting metadata keys.
+func (t *Typed[K, V]) Len() int {
+	return t.b.Len() - len(t.b.Keys([]byte(MetaPrefix)))
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// Event is a mutation delivered to a watcher. Expired keys show up as
+// deletes once they are reclaimed.
+type Event = Mutation
+
+// Overflow decides what happens when a watcher's buffer is full. Writers
+// never wait for watchers.
+type Overflow int
+
+const (
+	DropNewest Overflow = iota // discard the event that doesn't fit
+	DropOldest                 // discard the oldest buffered event
+	Disconnect                 // close the channel and stop watching
+)
+
+// WatchOption configures a single Watch call.
+type WatchOption func(*watcher)
+
+// WithBuffer sets the channel capacity. The default is 64.
+func WithBuffer(n int) WatchOption {
+	return func(w *watcher) { w.size = n }
+}
+
+// WithOverflow sets the overflow policy. The default is DropNewest.
+func WithOverflow(p Overflow) WatchOption {
+	return func(w *watcher) { w.policy = p }
+}
+
+type watcher struct {
+	prefix string
+	size   int
+	policy Overflow
+	ch     chan Event
+	quit   chan struct{}
+}
+
+// Watch streams every Put and Delete on keys starting with prefix. The
+// channel is closed when ctx is done, when m is closed, or on overflow
+// under the Disconnect policy.
+func (m *Mem) Watch(ctx context.Context, prefix []byte, opts ...WatchOption) (<-chan Event, error) {
+	w := &watcher{
+		prefix: string(prefix),
+		size:   64,
+		policy: DropNewest,
+		quit:   make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	w.ch = make(chan Event, max(w.size, 1))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	if m.watchers == nil {
+		m.watchers = make(map[*watcher]struct{})
+	}
+	m.watchers[w] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			m.unwatch(w)
+			m.mu.Unlock()
+		case <-w.quit:
+		}
+	}()
+
+	return w.ch, nil
+}
+
+// unwatch removes w and closes its channel. Caller must hold m.mu.
+func (m *Mem) unwatch(w *watcher) {
+	if _, ok := m.watchers[w]; !ok {
+		return
+	}
+
+	delete(m.watchers, w)
+	close(w.ch)
+	close(w.quit)
+}
+
+// notify fans an event out to matching watchers. Caller must hold m.mu
+// for writing, so there is only ever one sender per channel.
+func (m *Mem) notify(op Op, sk string, v []byte) {
+	for w := range m.watchers {
+		if !strings.HasPrefix(sk, w.prefix) {
+			continue
+		}
+
+		if !w.send(Event{Op: op, Key: []byte(sk), Value: clone(v)}) {
+			m.unwatch(w)
+		}
+	}
+}
+
+// send delivers ev without blocking. It reports false when the watcher
+// should be disconnected.
+func (w *watcher) send(ev Event) bool {
+	select {
+	case w.ch <- ev:
+		return true
+	default:
+	}
+
+	switch w.policy {
+	case DropOldest:
+		select {
+		case <-w.ch:
+		default:
+		}
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	case Disconnect:
+		return false
+	}
+
+	return true
+}